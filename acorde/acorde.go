@@ -0,0 +1,349 @@
+// Package acorde interpreta nomes de acordes, permitindo canonicalizá-los, transpô-los e representá-los
+// relativamente ao tom da música.
+//
+// A grafia canônica usa a notação comum nas cifras brasileiras: raiz com a enarmonia mais usual (C#, Eb, F#, G#,
+// Bb), qualidade da tríade (m, dim, aug), a primeira extensão numérica e as suspensões sem parênteses e as demais
+// extensões entre parênteses separadas por barra, seguidas do baixo. Por exemplo: "c#m(7)" e "Dbm7" viram "C#m7";
+// "Cmaj7" vira "C7M"; "Bm7b5" vira "Bm7(b5)"; "C7(9,11)" vira "C7(9/11)".
+package acorde
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Nomes das notas usados na representação canônica dos acordes, indexados por semitons a partir de C.
+var notas = []string{"C", "C#", "D", "Eb", "E", "F", "F#", "G", "G#", "A", "Bb", "B"}
+
+// Graus (em algarismos romanos) de cada intervalo em semitons a partir da tônica.
+var graus = []string{"I", "bII", "II", "bIII", "III", "IV", "#IV", "V", "bVI", "VI", "bVII", "VII"}
+
+var naturais = map[byte]int{'C': 0, 'D': 2, 'E': 4, 'F': 5, 'G': 7, 'A': 9, 'B': 11}
+
+const (
+	Maior       = ""
+	Menor       = "m"
+	Diminuto    = "dim"
+	Aumentado   = "aug"
+	SemBaixo    = -1
+	setimaMaior = "7M"
+
+	// Separa as extensões entre parênteses. Não pode ser vírgula, que separa os acordes nas listas.
+	separadorExtensoes = "/"
+)
+
+type Acorde struct {
+	Raiz      int      // Semitons a partir de C (0 a 11).
+	Qualidade string   // Qualidade da tríade: Maior, Menor, Diminuto ou Aumentado.
+	Extensoes []string // Extensões e suspensões já canonicalizadas, na ordem em que aparecem. Ex: "7", "b5", "sus4".
+	Baixo     int      // Semitons a partir de C do baixo invertido ou SemBaixo.
+}
+
+// Ordem importa: prefixos mais longos primeiro.
+var qualidades = []struct {
+	prefixo, qualidade string
+}{
+	{"dim", Diminuto},
+	{"aug", Aumentado},
+	{"°", Diminuto},
+	{"º", Diminuto},
+	{"ø", Menor}, // Meio-diminuto: a extensão 7(b5) é adicionada à parte.
+	{"-", Menor},
+	{"+", Aumentado},
+}
+
+var (
+	// Tokens aceitos como extensões, depois de removidos parênteses e separadores. Intervalos de dois dígitos vêm
+	// antes para que "11" e "13" não sejam lidos como "1".
+	extensao     = regexp.MustCompile(`^(maj7|M7|7M|7\+|add(9|11|13|2|4)|sus[24]?|[#b+\-]?(11|13|2|4|5|6|7|9)[+\-]?)`)
+	separadores  = strings.NewReplacer("(", " ", ")", " ", ",", " ", "/", " ", "♯", "#", "♭", "b")
+	apenasNumero = regexp.MustCompile(`^\d{1,2}$`)
+)
+
+// invalido é o acorde retornado junto com os erros de Parse.
+var invalido = Acorde{Baixo: SemBaixo}
+
+// Parse interpreta um nome de acorde como "C#m7(9)/G#". A letra da raiz pode ser minúscula.
+func Parse(s string) (Acorde, error) {
+	original := s
+	s = strings.TrimSpace(strings.Replace(strings.Replace(s, "♯", "#", -1), "♭", "b", -1))
+	if s == "" {
+		return invalido, fmt.Errorf("acorde vazio")
+	}
+	raiz, resto, ok := nota(s)
+	if !ok {
+		return invalido, fmt.Errorf("acorde inválido: %s", original)
+	}
+	a := Acorde{Raiz: raiz, Baixo: SemBaixo}
+
+	// Baixo invertido: a última barra seguida de uma nota. Barras seguidas de números (ex: 6/9) são extensões.
+	if i := strings.LastIndex(resto, "/"); i >= 0 {
+		if b, r, ok := nota(resto[i+1:]); ok && r == "" {
+			a.Baixo = b
+			resto = resto[:i]
+		}
+	}
+
+	// A qualidade. "m" precisa de cuidado para não ser confundido com "maj".
+	switch {
+	case strings.HasPrefix(resto, "m") && !strings.HasPrefix(resto, "maj"):
+		a.Qualidade = Menor
+		resto = resto[1:]
+		if strings.HasPrefix(resto, "in") {
+			resto = resto[2:]
+		}
+	default:
+		for _, q := range qualidades {
+			if strings.HasPrefix(resto, q.prefixo) {
+				a.Qualidade = q.qualidade
+				resto = resto[len(q.prefixo):]
+				if q.prefixo == "ø" {
+					a.Extensoes = append(a.Extensoes, "7", "b5")
+				}
+				break
+			}
+		}
+	}
+
+	// As extensões.
+	for _, campo := range strings.Fields(separadores.Replace(resto)) {
+		for campo != "" {
+			tok := extensao.FindString(campo)
+			if tok == "" {
+				return invalido, fmt.Errorf("acorde inválido: %s", original)
+			}
+			campo = campo[len(tok):]
+			// Números colados, como em "C7777", não formam extensões válidas.
+			if campo != "" && digito(tok[len(tok)-1]) && digito(campo[0]) {
+				return invalido, fmt.Errorf("acorde inválido: %s", original)
+			}
+			a.adicionaExtensao(canonicalizaExtensao(tok))
+		}
+	}
+	return a, nil
+}
+
+// nota interpreta uma nota (letra e acidente opcional) no início de s, retornando o restante.
+func nota(s string) (int, string, bool) {
+	if s == "" {
+		return 0, "", false
+	}
+	raiz, ok := naturais[strings.ToUpper(s[:1])[0]]
+	if !ok {
+		return 0, "", false
+	}
+	resto := s[1:]
+	switch {
+	case strings.HasPrefix(resto, "#"):
+		raiz++
+		resto = resto[1:]
+	case strings.HasPrefix(resto, "b"):
+		raiz--
+		resto = resto[1:]
+	}
+	return modulo(raiz), resto, true
+}
+
+func digito(c byte) bool {
+	return c >= '0' && c <= '9'
+}
+
+func canonicalizaExtensao(tok string) string {
+	switch {
+	case tok == "maj7" || tok == "M7" || tok == "7M" || tok == "7+":
+		return setimaMaior
+	case tok == "sus":
+		return "sus4"
+	case strings.HasPrefix(tok, "+"):
+		return "#" + tok[1:]
+	case strings.HasPrefix(tok, "-"):
+		return "b" + tok[1:]
+	case strings.HasSuffix(tok, "+"):
+		return "#" + tok[:len(tok)-1]
+	case strings.HasSuffix(tok, "-"):
+		return "b" + tok[:len(tok)-1]
+	}
+	return tok
+}
+
+func (a *Acorde) adicionaExtensao(ext string) {
+	for _, e := range a.Extensoes {
+		if e == ext {
+			return
+		}
+	}
+	a.Extensoes = append(a.Extensoes, ext)
+}
+
+// Sufixo retorna a parte canônica do acorde que vem após a raiz, sem o baixo. Ex: "m7(b5)" ou "7(9/11)".
+func (a Acorde) Sufixo() string {
+	sufixo := a.Qualidade
+	var parenteses []string
+	numero := false
+	for _, e := range a.Extensoes {
+		switch {
+		case strings.HasPrefix(e, "sus"):
+			sufixo += e
+		case !numero && (e == setimaMaior || apenasNumero.MatchString(e)):
+			sufixo += e
+			numero = true
+		default:
+			parenteses = append(parenteses, e)
+		}
+	}
+	if len(parenteses) > 0 {
+		sufixo += "(" + strings.Join(parenteses, separadorExtensoes) + ")"
+	}
+	return sufixo
+}
+
+func (a Acorde) String() string {
+	s := notas[a.Raiz] + a.Sufixo()
+	if a.Baixo != SemBaixo {
+		s += "/" + notas[a.Baixo]
+	}
+	return s
+}
+
+// Transpoe retorna o acorde deslocado pelo número de semitons passado (que pode ser negativo).
+func (a Acorde) Transpoe(semitons int) Acorde {
+	t := a
+	t.Raiz = modulo(a.Raiz + semitons)
+	if a.Baixo != SemBaixo {
+		t.Baixo = modulo(a.Baixo + semitons)
+	}
+	return t
+}
+
+// Grau retorna a representação do acorde relativa à tônica passada, por exemplo: Am em C é "VIm" e D/F# é "II/III".
+func (a Acorde) Grau(tonica int) string {
+	s := graus[modulo(a.Raiz-tonica)] + a.Sufixo()
+	if a.Baixo != SemBaixo {
+		s += "/" + graus[modulo(a.Baixo-tonica)]
+	}
+	return s
+}
+
+// Canonico retorna a grafia canônica do acorde. Se o acorde não puder ser interpretado, retorna o texto original
+// sem espaços nas extremidades, de forma que consultas e dados armazenados continuem concordando.
+func Canonico(s string) string {
+	a, err := Parse(s)
+	if err != nil {
+		return strings.TrimSpace(s)
+	}
+	return a.String()
+}
+
+// TonicaRelativa retorna a tônica usada para representar acordes em graus no tom passado. Tons menores usam a
+// tônica do relativo maior, de forma que Am em Am e em C tenha o mesmo grau (VIm).
+func TonicaRelativa(tom string) (int, error) {
+	t, err := Parse(tom)
+	if err != nil {
+		return 0, err
+	}
+	if t.Qualidade == Menor {
+		return modulo(t.Raiz + 3), nil
+	}
+	return t.Raiz, nil
+}
+
+// Graus converte os acordes para sua representação relativa ao tom. Acordes que não puderem ser interpretados
+// são ignorados.
+func Graus(tom string, acordes []string) ([]string, error) {
+	tonica, err := TonicaRelativa(tom)
+	if err != nil {
+		return nil, err
+	}
+	var res []string
+	for _, s := range acordes {
+		a, err := Parse(s)
+		if err != nil {
+			continue
+		}
+		res = append(res, a.Grau(tonica))
+	}
+	return res, nil
+}
+
+// Intervalo retorna o menor deslocamento em semitons (entre -5 e 6) que leva a raiz de origem até a de destino.
+func Intervalo(origem, destino int) int {
+	d := modulo(destino - origem)
+	if d > 6 {
+		d -= 12
+	}
+	return d
+}
+
+// NomeDaNota retorna a grafia canônica da nota.
+func NomeDaNota(semitons int) string {
+	return notas[modulo(semitons)]
+}
+
+// Início de cada acorde quando escritos sem separadores (ex: "BmGDA"): uma letra de nota que não seja baixo.
+var inicioDeAcorde = regexp.MustCompile(`[A-G]`)
+
+// Separa converte uma lista de acordes separados por vírgula em acordes canônicos. Por compatibilidade, também
+// aceita acordes escritos sem separadores, como "BmGDA".
+func Separa(s string) []string {
+	var res []string
+	for _, b := range brutos(s) {
+		res = append(res, Canonico(b))
+	}
+	return res
+}
+
+// SeparaEstrito é como Separa, mas retorna um erro no primeiro acorde que não puder ser interpretado em vez de
+// mantê-lo como foi escrito.
+func SeparaEstrito(s string) ([]string, error) {
+	var res []string
+	for _, b := range brutos(s) {
+		a, err := Parse(b)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, a.String())
+	}
+	return res, nil
+}
+
+// brutos divide a lista de acordes, sem interpretá-los, descartando os vazios. Vírgulas entre parênteses, como em
+// "C7(9,11)", separam extensões e não acordes.
+func brutos(s string) []string {
+	var partes []string
+	if strings.Contains(s, ",") {
+		inicio, nivel := 0, 0
+		for i, c := range s {
+			switch {
+			case c == '(':
+				nivel++
+			case c == ')' && nivel > 0:
+				nivel--
+			case c == ',' && nivel == 0:
+				partes = append(partes, s[inicio:i])
+				inicio = i + 1
+			}
+		}
+		partes = append(partes, s[inicio:])
+	} else {
+		inicio := 0
+		for _, idx := range inicioDeAcorde.FindAllStringIndex(s, -1) {
+			if idx[0] > inicio && s[idx[0]-1] != '/' {
+				partes = append(partes, s[inicio:idx[0]])
+				inicio = idx[0]
+			}
+		}
+		partes = append(partes, s[inicio:])
+	}
+	var res []string
+	for _, p := range partes {
+		if p = strings.TrimSpace(p); p != "" {
+			res = append(res, p)
+		}
+	}
+	return res
+}
+
+func modulo(n int) int {
+	return ((n % 12) + 12) % 12
+}
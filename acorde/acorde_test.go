@@ -0,0 +1,170 @@
+package acorde
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/danielfireman/deciframe-api/model"
+)
+
+func TestGraus(t *testing.T) {
+	acordes := []string{"Am", "F", "C", "G", "E7/G#"}
+	want := []string{"VIm", "IV", "I", "V", "III7/bVI"}
+	for _, tom := range []string{"C", "Am", "am"} {
+		got, err := Graus(tom, acordes)
+		if err != nil {
+			t.Fatalf("Graus(%q): %q", tom, err)
+		}
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("Graus(%q) = %v, want %v", tom, got, want)
+		}
+	}
+}
+
+func TestGraus_TomInvalido(t *testing.T) {
+	if _, err := Graus("H", []string{"C"}); err == nil {
+		t.Errorf("Graus(\"H\") deveria retornar erro")
+	}
+}
+
+func TestTonicaRelativa(t *testing.T) {
+	data := []struct {
+		tom    string
+		tonica int
+	}{
+		{"C", 0},
+		{"Am", 0},
+		{"F#m", 9},
+		{"Bbm", 1},
+		{"Eb", 3},
+		{"Cm7", 3},
+	}
+	for _, d := range data {
+		got, err := TonicaRelativa(d.tom)
+		if err != nil {
+			t.Fatalf("TonicaRelativa(%q): %q", d.tom, err)
+		}
+		if got != d.tonica {
+			t.Errorf("TonicaRelativa(%q) = %d, want %d", d.tom, got, d.tonica)
+		}
+	}
+}
+
+func TestCanonico(t *testing.T) {
+	data := []struct {
+		desc, acorde, want string
+	}{
+		{"natural", "C", "C"},
+		{"minúscula", "am", "Am"},
+		{"enarmonia sustenido", "A#", "Bb"},
+		{"enarmonia bemol", "Db", "C#"},
+		{"enarmonia menor com sétima", "Dbm7", "C#m7"},
+		{"enarmonia Gb", "Gb7", "F#7"},
+		{"enarmonia Cb", "Cb", "B"},
+		{"enarmonia E#", "E#m", "Fm"},
+		{"símbolos de acidente", "F♯m", "F#m"},
+		{"baixo enarmônico", "C/Bb", "C/Bb"},
+		{"baixo com sustenido", "D/F#", "D/F#"},
+		{"baixo com bemol", "Ab/Gb", "G#/F#"},
+		{"sétima maior", "Cmaj7", "C7M"},
+		{"sétima maior com mais", "C7+", "C7M"},
+		{"primeira extensão sem parênteses", "c#m(7)", "C#m7"},
+		{"meio diminuto", "Bm7b5", "Bm7(b5)"},
+		{"meio diminuto com símbolo", "Bø", "Bm7(b5)"},
+		{"extensões separadas por vírgula", "C7(9,11)", "C7(9/11)"},
+		{"extensões separadas por barra", "C7(9/11)", "C7(9/11)"},
+		{"extensões em parênteses separados", "C7(9)(11)", "C7(9/11)"},
+		{"extensões com baixo", "Cm7(b5,9)/Gb", "Cm7(b5/9)/F#"},
+		{"extensão com mais", "C7(9+)", "C7(#9)"},
+		{"extensão com menos", "C7(-13)", "C7(b13)"},
+		{"seis e nove", "C6/9", "C6(9)"},
+		{"suspensão", "Csus", "Csus4"},
+		{"suspensão com extensão", "G7sus4(9)", "G7sus4(9)"},
+		{"add", "C(add9)", "C(add9)"},
+		{"extensão repetida", "C7(7)", "C7"},
+		{"diminuto", "C°", "Cdim"},
+		{"aumentado", "C+", "Caug"},
+		{"espaços", "  G  ", "G"},
+	}
+	for _, d := range data {
+		if got := Canonico(d.acorde); got != d.want {
+			t.Errorf("%s: Canonico(%q) = %q, want %q", d.desc, d.acorde, got, d.want)
+		}
+		// A grafia canônica também deve ser canônica.
+		if got := Canonico(d.want); got != d.want {
+			t.Errorf("%s: Canonico(%q) = %q, want %q", d.desc, d.want, got, d.want)
+		}
+	}
+}
+
+func TestParse_Invalido(t *testing.T) {
+	for _, s := range []string{"", "H", "C7777", "C99999", "C1", "C8", "C10", "C(add7)", "C7(9,x)", "Cxyz"} {
+		a, err := Parse(s)
+		if err == nil {
+			t.Errorf("Parse(%q) = %q, want erro", s, a)
+			continue
+		}
+		if a.Baixo != SemBaixo {
+			t.Errorf("Parse(%q) com erro: Baixo = %d, want SemBaixo", s, a.Baixo)
+		}
+	}
+}
+
+func TestSeparaEstrito(t *testing.T) {
+	data := []struct {
+		acordes string
+		want    []string
+	}{
+		{"C,G,Am,F", []string{"C", "G", "Am", "F"}},
+		{"C7(9,11),G", []string{"C7(9/11)", "G"}},
+		{"Cm7(b5,9)/Gb, Db", []string{"Cm7(b5/9)/F#", "C#"}},
+		{"C7(9/11),G", []string{"C7(9/11)", "G"}},
+		{"BmGDA", []string{"Bm", "G", "D", "A"}},
+		{"C,,G", []string{"C", "G"}},
+	}
+	for _, d := range data {
+		got, err := SeparaEstrito(d.acordes)
+		if err != nil {
+			t.Errorf("SeparaEstrito(%q): %q", d.acordes, err)
+			continue
+		}
+		if !reflect.DeepEqual(got, d.want) {
+			t.Errorf("SeparaEstrito(%q) = %q, want %q", d.acordes, got, d.want)
+		}
+	}
+	if _, err := SeparaEstrito("C,C7777"); err == nil {
+		t.Errorf("SeparaEstrito(\"C,C7777\") deveria retornar erro")
+	}
+}
+
+func TestIdentifica(t *testing.T) {
+	seqs := []*model.Sequencia{
+		{ID: "0", Graus: []string{"VIm", "IV", "I", "V"}},
+		{ID: "1", Graus: []string{"I", "V", "VIm", "IV"}},
+	}
+	data := []struct {
+		acordes []string
+		wantID  string
+		wantTom string
+	}{
+		{[]string{"Am", "F", "C", "G"}, "0", "C"},
+		{[]string{"D", "A", "Bm", "G"}, "1", "D"},
+		{[]string{"C", "G", "Am"}, "", ""},
+		{[]string{"C", "G", "Am", "Dm"}, "", ""},
+	}
+	for _, d := range data {
+		got, ok := Identifica(seqs, d.acordes)
+		if d.wantID == "" {
+			if ok {
+				t.Errorf("Identifica(%q) = %+v, want nenhuma", d.acordes, got)
+			}
+			continue
+		}
+		if !ok || got.ID != d.wantID || got.Tom != d.wantTom {
+			t.Errorf("Identifica(%q) = %+v, %v, want id %s em %s", d.acordes, got, ok, d.wantID, d.wantTom)
+		}
+	}
+	if seqs[0].Tom != "" {
+		t.Errorf("Identifica alterou a sequência armazenada: %+v", seqs[0])
+	}
+}
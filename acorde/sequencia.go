@@ -0,0 +1,88 @@
+package acorde
+
+import "github.com/danielfireman/deciframe-api/model"
+
+// Sequencia é uma progressão de acordes descrita por graus, independente de tom.
+type Sequencia struct {
+	ID      string
+	Nome    string
+	Graus   []string // Ex: "VIm", "IV", "I", "V".
+	Acordes []string // A progressão em um tom de exemplo.
+}
+
+// SequenciasFamosas são as progressões detectadas pelo loader. Os IDs são os mesmos da coluna de sequências famosas
+// do CSV original, portanto não devem ser alterados.
+var SequenciasFamosas = []Sequencia{
+	{ID: "0", Nome: "vi-IV-I-V", Graus: []string{"VIm", "IV", "I", "V"}, Acordes: []string{"Bm", "G", "D", "A"}},
+	{ID: "1", Nome: "I-V-vi-IV", Graus: []string{"I", "V", "VIm", "IV"}, Acordes: []string{"C", "G", "Am", "F"}},
+	{ID: "2", Nome: "vi-I", Graus: []string{"VIm", "I"}, Acordes: []string{"Em", "G"}},
+	{ID: "3", Nome: "I-VI7-ii-V7", Graus: []string{"I", "VI7", "IIm", "V7"}, Acordes: []string{"C", "A7", "Dm", "G7"}},
+	{ID: "4", Nome: "i-bVII", Graus: []string{"Im", "bVII"}, Acordes: []string{"Gm", "F"}},
+	{ID: "5", Nome: "I-I7-IV-iv", Graus: []string{"I", "I7", "IV", "IVm"}, Acordes: []string{"C", "C7", "F", "Fm"}},
+}
+
+// Tonica verifica se os acordes formam exatamente a sequência em algum tom, retornando a tônica correspondente
+// (em semitons a partir de C).
+func (s Sequencia) Tonica(acordes []string) (int, bool) {
+	if len(acordes) != len(s.Graus) || len(acordes) == 0 {
+		return 0, false
+	}
+	parsed := make([]Acorde, len(acordes))
+	for i, str := range acordes {
+		a, err := Parse(str)
+		if err != nil {
+			return 0, false
+		}
+		parsed[i] = a
+	}
+	for t := 0; t < 12; t++ {
+		casou := true
+		for i, a := range parsed {
+			if a.Grau(t) != s.Graus[i] {
+				casou = false
+				break
+			}
+		}
+		if casou {
+			return t, true
+		}
+	}
+	return 0, false
+}
+
+// Identifica procura, entre as sequências armazenadas, a formada pelos acordes em qualquer tom. A sequência
+// retornada é uma cópia com o campo Tom preenchido.
+func Identifica(seqs []*model.Sequencia, acordes []string) (*model.Sequencia, bool) {
+	for _, s := range seqs {
+		t, ok := Sequencia{Graus: s.Graus}.Tonica(acordes)
+		if ok {
+			encontrada := *s
+			encontrada.Tom = NomeDaNota(t)
+			return &encontrada, true
+		}
+	}
+	return nil, false
+}
+
+// ContidaEm verifica se a sequência aparece de forma contígua na cifra, em qualquer tom. Repetições consecutivas
+// de um mesmo acorde na cifra são desconsideradas.
+func (s Sequencia) ContidaEm(cifra []string) bool {
+	cifra = SemRepeticoes(cifra)
+	for i := 0; i+len(s.Graus) <= len(cifra); i++ {
+		if _, ok := s.Tonica(cifra[i : i+len(s.Graus)]); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// SemRepeticoes remove repetições consecutivas de acordes.
+func SemRepeticoes(cifra []string) []string {
+	var res []string
+	for _, c := range cifra {
+		if len(res) == 0 || res[len(res)-1] != c {
+			res = append(res, c)
+		}
+	}
+	return res
+}
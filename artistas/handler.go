@@ -0,0 +1,138 @@
+package artistas
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/danielfireman/deciframe-api/db"
+	"github.com/danielfireman/deciframe-api/erro"
+	"github.com/danielfireman/deciframe-api/model"
+	"github.com/danielfireman/deciframe-api/resposta"
+	"github.com/danielfireman/deciframe-api/telemetria"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	TAM_PAGINA = 100
+
+	// Páginas maiores estão sempre além do fim: o repositório não pula mais que db.MAX_PULAR artistas.
+	MAX_PAGINA = db.MAX_PULAR/TAM_PAGINA + 1
+)
+
+type HandlerFactory struct {
+	mon telemetria.Telemetria
+	db  db.Repositorio
+}
+
+func FabricaDeTratadores(db db.Repositorio, mon telemetria.Telemetria) *HandlerFactory {
+	return &HandlerFactory{
+		mon: mon,
+		db:  db,
+	}
+}
+
+// PaginaArtistas é o envelope das respostas de /artistas, com os mesmos campos de paginação de /similares.
+type PaginaArtistas struct {
+	Total      int              `json:"total"`             // Número de artistas com o prefixo pedido.
+	Pagina     int              `json:"pagina"`            // Página atual, começando de 1.
+	Tamanho    int              `json:"tamanho"`           // Número máximo de artistas por página.
+	Proxima    string           `json:"proxima,omitempty"` // Links para as páginas vizinhas.
+	Anterior   string           `json:"anterior,omitempty"`
+	Resultados []*model.Artista `json:"resultados"`
+}
+
+// ArtistaResposta é o artista com suas músicas.
+type ArtistaResposta struct {
+	*model.Artista
+	Musicas []*model.Musica `json:"musicas"`
+}
+
+// GetHandler lista os artistas em ordem alfabética, TAM_PAGINA por página (pagina de 1 a MAX_PAGINA), em um
+// PaginaArtistas. O parâmetro nome filtra os artistas cujo nome começa com o prefixo passado.
+func (s *HandlerFactory) GetHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		txn := s.mon.IniciaTransacao("artistas", w, r)
+		defer txn.Fim()
+
+		pagina := 1
+		if r.URL.Query().Get("pagina") != "" {
+			var err error
+			pagina, err = strconv.Atoi(r.URL.Query().Get("pagina"))
+			if err != nil || pagina < 1 || pagina > MAX_PAGINA {
+				erro.Escreve(txn, r, erro.ParametroInvalido(
+					fmt.Sprintf("pagina deve ser um inteiro entre 1 e %d: %s", MAX_PAGINA, r.URL.Query().Get("pagina")),
+					fmt.Sprintf("pagina must be an integer between 1 and %d: %s", MAX_PAGINA, r.URL.Query().Get("pagina"))))
+				return
+			}
+		}
+
+		buscaSeg := txn.Segmento("busca_artistas")
+		artistas, total, err := s.db.BuscaArtistas(r.Context(), r.URL.Query().Get("nome"), pagina, TAM_PAGINA)
+		buscaSeg.Fim()
+		if err != nil {
+			log.Printf("Erro processando request [%s]: '%q'\n", r.URL.String(), err)
+			erro.Escreve(txn, r, erro.Interno(err))
+			return
+		}
+		res := &PaginaArtistas{Total: total, Pagina: pagina, Tamanho: TAM_PAGINA, Resultados: artistas}
+		if res.Resultados == nil {
+			res.Resultados = []*model.Artista{}
+		}
+		ultima := (total + TAM_PAGINA - 1) / TAM_PAGINA
+		if pagina < ultima {
+			res.Proxima = link(r, pagina+1)
+		}
+		if pagina > 1 {
+			// A página anterior de uma página além do fim é a última página com resultados.
+			anterior := pagina - 1
+			if anterior > ultima && ultima > 0 {
+				anterior = ultima
+			}
+			res.Anterior = link(r, anterior)
+		}
+		resposta.JSON(txn, r, res)
+	}
+}
+
+// MusicasHandler retorna o artista identificado pelo parâmetro de rota id_artista e suas músicas, das mais
+// populares para as menos populares.
+func (s *HandlerFactory) MusicasHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		txn := s.mon.IniciaTransacao("artistas_musicas", w, r)
+		defer txn.Fim()
+
+		buscaArtistaSeg := txn.Segmento("busca_artista")
+		artista, err := s.db.BuscaArtistaPorID(r.Context(), p.ByName("id_artista"))
+		buscaArtistaSeg.Fim()
+		if err != nil {
+			if db.NaoEncontrado(err) {
+				erro.Escreve(txn, r, erro.NaoEncontrado(
+					"Artista não encontrado: "+p.ByName("id_artista"),
+					"Artist not found: "+p.ByName("id_artista")))
+				return
+			}
+			log.Printf("Erro processando request [%s]: '%q'\n", r.URL.String(), err)
+			erro.Escreve(txn, r, erro.Interno(err))
+			return
+		}
+
+		buscaMusicasSeg := txn.Segmento("busca_musicas_artista")
+		musicas, err := s.db.BuscaMusicasPorArtista(r.Context(), artista.ID)
+		buscaMusicasSeg.Fim()
+		if err != nil {
+			log.Printf("Erro processando request [%s]: '%q'\n", r.URL.String(), err)
+			erro.Escreve(txn, r, erro.Interno(err))
+			return
+		}
+		resposta.JSON(txn, r, &ArtistaResposta{Artista: artista, Musicas: musicas})
+	}
+}
+
+// link retorna a URL da requisição (relativa ao servidor) apontando para outra página.
+func link(r *http.Request, pagina int) string {
+	q := r.URL.Query()
+	q.Set("pagina", strconv.Itoa(pagina))
+	return r.URL.Path + "?" + q.Encode()
+}
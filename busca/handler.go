@@ -0,0 +1,113 @@
+package busca
+
+import (
+	"log"
+	"math"
+	"net/http"
+	"sort"
+
+	"github.com/danielfireman/deciframe-api/db"
+	"github.com/danielfireman/deciframe-api/erro"
+	"github.com/danielfireman/deciframe-api/resposta"
+	"github.com/danielfireman/deciframe-api/telemetria"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	// Número de músicas mais relevantes (pelo texto) consideradas antes de ponderar pela popularidade.
+	NUM_CANDIDATOS = 500
+	TAM_PAGINA     = 100
+
+	// Peso da relevância textual na pontuação final. O restante corresponde à popularidade.
+	PESO_TEXTO = 0.7
+)
+
+type BuscaResposta struct {
+	UniqueID     string  `json:"id_unico_musica"`
+	IDArtista    string  `json:"id_artista"`
+	ID           string  `json:"id_musica"`
+	Artista      string  `json:"nome_artista"`
+	Nome         string  `json:"nome_musica"`
+	Popularidade int     `json:"popularidade"`
+	Genero       string  `json:"genero"`
+	URL          string  `json:"url"`
+	Pontuacao    float64 `json:"pontuacao"`
+}
+
+type HandlerFactory struct {
+	mon telemetria.Telemetria
+	db  db.Repositorio
+}
+
+func FabricaDeTratadores(db db.Repositorio, mon telemetria.Telemetria) *HandlerFactory {
+	return &HandlerFactory{
+		mon: mon,
+		db:  db,
+	}
+}
+
+// GetHandler busca músicas pelo nome da música ou do artista (parâmetro q), ignorando caixa e acentos.
+func (s *HandlerFactory) GetHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		txn := s.mon.IniciaTransacao("busca", w, r)
+		defer txn.Fim()
+
+		q := r.URL.Query().Get("q")
+		if q == "" {
+			erro.Escreve(txn, r, erro.ParametroInvalido(
+				"O parâmetro q é obrigatório.",
+				"The q parameter is required."))
+			return
+		}
+
+		buscaSeg := txn.Segmento("busca_textual")
+		encontradas, err := s.db.BuscaTextual(r.Context(), q, NUM_CANDIDATOS)
+		buscaSeg.Fim()
+		if err != nil {
+			log.Printf("Erro processando request [%s]: '%q'\n", r.URL.String(), err)
+			erro.Escreve(txn, r, erro.Interno(err))
+			return
+		}
+
+		response := pontua(encontradas)
+		if len(response) > TAM_PAGINA {
+			response = response[:TAM_PAGINA]
+		}
+		resposta.JSON(txn, r, response)
+	}
+}
+
+// pontua combina a relevância textual e a popularidade, ambas normalizadas entre 0 e 1 em relação ao maior valor
+// encontrado. A popularidade é considerada em escala logarítmica, para que músicas muito populares não dominem.
+func pontua(encontradas []*db.Relevante) []*BuscaResposta {
+	maxRelevancia, maxPopularidade := 0.0, 0.0
+	for _, e := range encontradas {
+		maxRelevancia = math.Max(maxRelevancia, e.Relevancia)
+		maxPopularidade = math.Max(maxPopularidade, math.Log1p(float64(e.Popularidade)))
+	}
+	response := []*BuscaResposta{}
+	for _, e := range encontradas {
+		var relevancia, popularidade float64
+		if maxRelevancia > 0 {
+			relevancia = e.Relevancia / maxRelevancia
+		}
+		if maxPopularidade > 0 {
+			popularidade = math.Log1p(float64(e.Popularidade)) / maxPopularidade
+		}
+		response = append(response, &BuscaResposta{
+			UniqueID:     e.UniqueID,
+			IDArtista:    e.IDArtista,
+			ID:           e.ID,
+			Artista:      e.Artista,
+			Nome:         e.Nome,
+			Popularidade: e.Popularidade,
+			Genero:       e.Genero,
+			URL:          e.URL,
+			Pontuacao:    PESO_TEXTO*relevancia + (1-PESO_TEXTO)*popularidade,
+		})
+	}
+	sort.SliceStable(response, func(i, j int) bool {
+		return response[i].Pontuacao > response[j].Pontuacao
+	})
+	return response
+}
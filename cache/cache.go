@@ -0,0 +1,69 @@
+// Package cache define a interface de cache usada pelos tratadores e suas implementações: Redis, LRU em memória e
+// duas camadas (LRU local na frente do Redis).
+package cache
+
+import (
+	"context"
+	"errors"
+	"time"
+)
+
+// ErrCacheMiss é retornado por Get quando a chave não está no cache (ou expirou).
+var ErrCacheMiss = errors.New("cache: chave não encontrada")
+
+// Cache é usado pelos tratadores com o contexto da requisição: se o contexto terminar antes da resposta do cache,
+// o erro do contexto é retornado.
+type Cache interface {
+	// Get preenche objeto com o valor armazenado na chave. Retorna ErrCacheMiss se a chave não existir.
+	Get(ctx context.Context, chave string, objeto interface{}) error
+
+	// Set armazena objeto na chave por, no máximo, o tempo de expiração passado.
+	Set(ctx context.Context, chave string, objeto interface{}, expiracao time.Duration) error
+
+	// Ping verifica se o cache está acessível.
+	Ping(ctx context.Context) error
+
+	// Close libera as conexões do cache.
+	Close() error
+}
+
+type duasCamadas struct {
+	local, remoto  Cache
+	expiracaoLocal time.Duration
+}
+
+// DuasCamadas coloca o cache local na frente do remoto. Leituras que encontram o valor no remoto também o
+// colocam no local, onde permanece por até expiracaoLocal.
+func DuasCamadas(local, remoto Cache, expiracaoLocal time.Duration) Cache {
+	return &duasCamadas{local: local, remoto: remoto, expiracaoLocal: expiracaoLocal}
+}
+
+func (c *duasCamadas) Get(ctx context.Context, chave string, objeto interface{}) error {
+	if err := c.local.Get(ctx, chave, objeto); err == nil {
+		return nil
+	}
+	if err := c.remoto.Get(ctx, chave, objeto); err != nil {
+		return err
+	}
+	c.local.Set(ctx, chave, objeto, c.expiracaoLocal)
+	return nil
+}
+
+// Ping verifica apenas o cache remoto, pois o local está sempre disponível.
+func (c *duasCamadas) Ping(ctx context.Context) error {
+	return c.remoto.Ping(ctx)
+}
+
+func (c *duasCamadas) Close() error {
+	c.local.Close()
+	return c.remoto.Close()
+}
+
+func (c *duasCamadas) Set(ctx context.Context, chave string, objeto interface{}, expiracao time.Duration) error {
+	local := expiracao
+	if c.expiracaoLocal < local {
+		local = c.expiracaoLocal
+	}
+	c.local.Set(ctx, chave, objeto, local)
+	return c.remoto.Set(ctx, chave, objeto, expiracao)
+}
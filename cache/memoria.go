@@ -0,0 +1,64 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"time"
+
+	"gopkg.in/go-redis/cache.v4/lrucache"
+)
+
+type entrada struct {
+	valor  []byte
+	expira time.Time
+}
+
+type memoria struct {
+	lru *lrucache.Cache
+}
+
+// Memoria cria um cache LRU em memória com no máximo tamanho entradas, cada uma válida por no máximo ttl. Os
+// valores são armazenados serializados, de forma que quem lê nunca compartilha o objeto com quem escreveu.
+func Memoria(tamanho int, ttl time.Duration) Cache {
+	return &memoria{lru: lrucache.New(ttl, tamanho)}
+}
+
+func (c *memoria) Get(ctx context.Context, chave string, objeto interface{}) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	v, ok := c.lru.Get(chave)
+	if !ok {
+		return ErrCacheMiss
+	}
+	e := v.(*entrada)
+	if !e.expira.IsZero() && time.Now().After(e.expira) {
+		c.lru.Delete(chave)
+		return ErrCacheMiss
+	}
+	return json.Unmarshal(e.valor, objeto)
+}
+
+func (c *memoria) Set(ctx context.Context, chave string, objeto interface{}, expiracao time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	b, err := json.Marshal(objeto)
+	if err != nil {
+		return err
+	}
+	e := &entrada{valor: b}
+	if expiracao > 0 {
+		e.expira = time.Now().Add(expiracao)
+	}
+	c.lru.Set(chave, e)
+	return nil
+}
+
+func (c *memoria) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+func (c *memoria) Close() error {
+	return nil
+}
@@ -0,0 +1,77 @@
+package cache
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+type valor struct {
+	Acordes []string
+}
+
+func TestMemoria_GetSet(t *testing.T) {
+	c := Memoria(10, time.Minute)
+	ctx := context.Background()
+	var v valor
+	if err := c.Get(ctx, "chave", &v); err != ErrCacheMiss {
+		t.Fatalf("Get antes de Set = %q, want ErrCacheMiss", err)
+	}
+	original := valor{Acordes: []string{"C", "G"}}
+	if err := c.Set(ctx, "chave", original, time.Minute); err != nil {
+		t.Fatalf("Set: %q", err)
+	}
+	// Quem escreveu não compartilha o valor com quem lê.
+	original.Acordes[0] = "D"
+	if err := c.Get(ctx, "chave", &v); err != nil {
+		t.Fatalf("Get: %q", err)
+	}
+	if want := []string{"C", "G"}; !reflect.DeepEqual(v.Acordes, want) {
+		t.Errorf("Get = %v, want %v", v.Acordes, want)
+	}
+}
+
+func TestMemoria_Expiracao(t *testing.T) {
+	c := Memoria(10, time.Minute)
+	ctx := context.Background()
+	if err := c.Set(ctx, "chave", valor{}, time.Millisecond); err != nil {
+		t.Fatalf("Set: %q", err)
+	}
+	time.Sleep(5 * time.Millisecond)
+	var v valor
+	if err := c.Get(ctx, "chave", &v); err != ErrCacheMiss {
+		t.Errorf("Get depois da expiração = %q, want ErrCacheMiss", err)
+	}
+}
+
+func TestMemoria_ContextoCancelado(t *testing.T) {
+	c := Memoria(10, time.Minute)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if err := c.Set(ctx, "chave", valor{}, time.Minute); err != context.Canceled {
+		t.Errorf("Set com contexto cancelado = %q, want %q", err, context.Canceled)
+	}
+	var v valor
+	if err := c.Get(ctx, "chave", &v); err != context.Canceled {
+		t.Errorf("Get com contexto cancelado = %q, want %q", err, context.Canceled)
+	}
+}
+
+func TestDuasCamadas(t *testing.T) {
+	local, remoto := Memoria(10, time.Minute), Memoria(10, time.Minute)
+	c := DuasCamadas(local, remoto, time.Minute)
+	ctx := context.Background()
+	if err := remoto.Set(ctx, "chave", valor{Acordes: []string{"Am"}}, time.Minute); err != nil {
+		t.Fatalf("Set: %q", err)
+	}
+	var v valor
+	if err := c.Get(ctx, "chave", &v); err != nil {
+		t.Fatalf("Get: %q", err)
+	}
+	// A leitura no remoto preenche o local.
+	var l valor
+	if err := local.Get(ctx, "chave", &l); err != nil || !reflect.DeepEqual(l, v) {
+		t.Errorf("local.Get = (%v, %q), want (%v, nil)", l, err, v)
+	}
+}
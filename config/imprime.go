@@ -0,0 +1,45 @@
+package config
+
+import (
+	"io"
+	"net/url"
+
+	"gopkg.in/yaml.v2"
+)
+
+const OCULTO = "xxxxx"
+
+// Imprime escreve a configuração em YAML, no formato aceito pelo arquivo de configuração, com os segredos
+// ocultos: a licença do New Relic e as senhas das URLs do MongoDB e do Redis.
+func (c *Config) Imprime(w io.Writer) error {
+	redigida := *c
+	redigida.MongoDBURI = redigeURL(c.MongoDBURI)
+	redigida.RedisURL = redigeURL(c.RedisURL)
+	if c.NewRelicLicenca != "" {
+		redigida.NewRelicLicenca = OCULTO
+	}
+	b, err := yaml.Marshal(&redigida)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(b)
+	return err
+}
+
+// redigeURL oculta a senha da URL. URLs que não podem ser interpretadas são ocultadas por inteiro.
+func redigeURL(u string) string {
+	if u == "" {
+		return ""
+	}
+	p, err := url.Parse(u)
+	if err != nil {
+		return OCULTO
+	}
+	if p.User == nil {
+		return u
+	}
+	if _, ok := p.User.Password(); ok {
+		p.User = url.UserPassword(p.User.Username(), OCULTO)
+	}
+	return p.String()
+}
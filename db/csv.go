@@ -0,0 +1,260 @@
+package db
+
+import (
+	"bufio"
+	"io"
+	"log"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/danielfireman/deciframe-api/acorde"
+	sets "github.com/deckarep/golang-set"
+)
+
+// Colunas do CSV de músicas.
+const (
+	ARTISTA_ID   = 0
+	MUSICA_ID    = 1
+	ARTISTA      = 2
+	MUSICA       = 3
+	GENERO       = 4
+	POPULARIDADE = 5
+	TOM          = 6
+	SEQ_FAMOSA   = 7
+	CIFRA        = 8
+)
+
+const (
+	// Número de músicas usadas como exemplo de cada sequência famosa.
+	NUM_EXEMPLOS = 5
+
+	// Número de acordes mais usados guardados para cada artista.
+	NUM_ACORDES_MAIS_USADOS = 10
+)
+
+// LeCSV lê as músicas no formato do CSV usado pelo loader, já com acordes canonicalizados, graus, cifra e
+// sequências famosas detectadas. Músicas sem acordes e linhas vazias são descartadas, assim como linhas sem todas
+// as colunas, que são registradas no log.
+func LeCSV(r io.Reader) ([]*M, error) {
+	scanner := bufio.NewScanner(r)
+	var musicas []*M
+	for numLinha := 1; scanner.Scan(); numLinha++ {
+		// Pré-processando cada linha.
+		linha := scanner.Text()
+		if strings.TrimSpace(linha) == "" {
+			continue
+		}
+		linha = strings.Replace(linha, "\"", "", -1)
+		linha = strings.Replace(linha, "NA", "", -1)
+		dados := strings.Split(linha, ",")
+		if len(dados) <= CIFRA {
+			log.Printf("Linha %d do CSV ignorada: %d colunas, esperadas %d.\n", numLinha, len(dados), CIFRA+1)
+			continue
+		}
+		m := &M{
+			IDUnicoMusica: IDUnicoMusica(dados[ARTISTA_ID], dados[MUSICA_ID]),
+			Artista:       dados[ARTISTA],
+			IDArtista:     dados[ARTISTA_ID],
+			ID:            dados[MUSICA_ID],
+			Nome:          dados[MUSICA],
+			Genero:        dados[GENERO],
+			Tom:           dados[TOM],
+			NomeBusca:     Normaliza(dados[MUSICA]),
+			ArtistaBusca:  Normaliza(dados[ARTISTA]),
+		}
+
+		var err error
+		m.Popularidade, err = strconv.Atoi(strings.Replace(dados[POPULARIDADE], ".", "", -1))
+		if err != nil {
+			return nil, err
+		}
+
+		seqFTrim := strings.Trim(dados[SEQ_FAMOSA], " ")
+		if seqFTrim != "" && seqFTrim != "NA" {
+			m.SeqFamosas = strings.Split(seqFTrim, ";")
+		}
+		m.Cifra = cifraCanonica(dados[CIFRA])
+		m.SeqFamosas = detectaSequencias(m.SeqFamosas, m.Cifra)
+
+		// Tratando acordes como um campo obrigatório. Não adicionando se não tiver acordes.
+		a := acordes(m.Cifra)
+		if len(a) > 0 {
+			m.Acordes = a
+			// Sem o tom não é possível calcular os graus, mas a música continua disponível para buscas por acordes.
+			if g, err := acorde.Graus(m.Tom, a); err == nil {
+				m.Graus = g
+			}
+			musicas = append(musicas, m)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+	return musicas, nil
+}
+
+// detectaSequencias acrescenta às sequências já informadas no CSV as sequências famosas encontradas na cifra.
+func detectaSequencias(seqFamosas []string, cifra []string) []string {
+	encontradas := sets.NewThreadUnsafeSet()
+	for _, s := range seqFamosas {
+		encontradas.Add(s)
+	}
+	for _, s := range acorde.SequenciasFamosas {
+		if !encontradas.Contains(s.ID) && s.ContidaEm(cifra) {
+			seqFamosas = append(seqFamosas, s.ID)
+			encontradas.Add(s.ID)
+		}
+	}
+	return seqFamosas
+}
+
+// Unicas descarta as músicas com id_unico_musica repetido, mantendo a primeira ocorrência de cada um, como faz o
+// índice único do MongoDB. As agregações (Sequencias e Artistas) devem ser calculadas sobre o resultado, para que
+// as repetições não contem mais de uma vez.
+func Unicas(musicas []*M) []*M {
+	vistas := make(map[string]bool, len(musicas))
+	var res []*M
+	for _, m := range musicas {
+		if !vistas[m.IDUnicoMusica] {
+			vistas[m.IDUnicoMusica] = true
+			res = append(res, m)
+		}
+	}
+	return res
+}
+
+// Sequencias monta o registro de cada sequência famosa, usando como exemplos as músicas mais populares que a contém.
+func Sequencias(musicas []*M) []*S {
+	var res []*S
+	for _, s := range acorde.SequenciasFamosas {
+		var exemplos []*M
+		for _, m := range musicas {
+			for _, id := range m.SeqFamosas {
+				if id == s.ID {
+					exemplos = append(exemplos, m)
+					break
+				}
+			}
+		}
+		sort.Stable(porPopularidade(exemplos))
+		seq := &S{
+			ID:      s.ID,
+			Nome:    s.Nome,
+			Graus:   s.Graus,
+			Acordes: s.Acordes,
+		}
+		for i := 0; i < len(exemplos) && i < NUM_EXEMPLOS; i++ {
+			seq.Exemplos = append(seq.Exemplos, exemplos[i].IDUnicoMusica)
+		}
+		res = append(res, seq)
+	}
+	return res
+}
+
+type porPopularidade []*M
+
+func (p porPopularidade) Len() int           { return len(p) }
+func (p porPopularidade) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p porPopularidade) Less(i, j int) bool { return p[i].Popularidade > p[j].Popularidade }
+
+// Artistas agrega as músicas por artista.
+func Artistas(musicas []*M) []*A {
+	porID := make(map[string]*A)
+	contagens := make(map[string]map[string]int)
+	var res []*A
+	for _, m := range musicas {
+		a, ok := porID[m.IDArtista]
+		if !ok {
+			a = &A{
+				ID:        m.IDArtista,
+				Nome:      m.Artista,
+				NomeBusca: Normaliza(m.Artista),
+			}
+			porID[m.IDArtista] = a
+			contagens[m.IDArtista] = make(map[string]int)
+			res = append(res, a)
+		}
+		a.NumMusicas++
+		a.Popularidade += m.Popularidade
+		for _, c := range m.Acordes {
+			contagens[m.IDArtista][c]++
+		}
+	}
+	for _, a := range res {
+		a.AcordesMaisUsados = maisUsados(contagens[a.ID], NUM_ACORDES_MAIS_USADOS)
+	}
+	return res
+}
+
+// maisUsados retorna os n acordes com maior contagem. Empates são resolvidos pela ordem alfabética.
+func maisUsados(contagem map[string]int, n int) []string {
+	var acordes []string
+	for c := range contagem {
+		acordes = append(acordes, c)
+	}
+	sort.Slice(acordes, func(i, j int) bool {
+		if contagem[acordes[i]] != contagem[acordes[j]] {
+			return contagem[acordes[i]] > contagem[acordes[j]]
+		}
+		return acordes[i] < acordes[j]
+	})
+	if len(acordes) > n {
+		acordes = acordes[:n]
+	}
+	return acordes
+}
+
+// cifraCanonica retorna a sequência de acordes da cifra, na ordem em que aparecem e já canonicalizados.
+func cifraCanonica(strCifra string) []string {
+	var cifra []string
+	for _, c := range limpaCifra(strCifra) {
+		cifra = append(cifra, acorde.Canonico(c))
+	}
+	return cifra
+}
+
+// acordes retorna os acordes distintos da cifra.
+func acordes(cifra []string) []string {
+	acordes := sets.NewSet()
+	for _, c := range cifra {
+		acordes.Add(c)
+	}
+	var result []string
+	for c := range acordes.Iter() {
+		result = append(result, c.(string))
+	}
+	return result
+}
+
+func limpaCifra(strCifra string) []string {
+	if strCifra == "" {
+		return []string{}
+	}
+	var cifra []string
+	rawCifra := strings.Split(strCifra, ";")
+	for _, m := range rawCifra {
+		m = strings.Trim(m, " ")
+		if len(m) != 0 {
+			if strings.Contains(m, "|") {
+				// filtra tablaturas
+				acorde := strings.Split(m, "|")[0]
+				acorde = pythonSplit(acorde)[0]
+				cifra = append(cifra, acorde)
+			} else {
+				// lida com acordes separados por espaço
+				cifra = append(cifra, pythonSplit(m)...)
+			}
+		}
+	}
+	return cifra
+}
+
+// Mais perto que consegui da função split() em python.
+// A idéia é converter múltiplos espaços consecutivos em um espaço e então fazer split.
+var multiplosEspacos = regexp.MustCompile(" +")
+
+func pythonSplit(s string) []string {
+	return strings.Split(multiplosEspacos.ReplaceAllString(s, " "), " ")
+}
@@ -1,30 +1,14 @@
 package main
 
 import (
-	"bufio"
 	"fmt"
 	"log"
 	"os"
-	"regexp"
-	"strconv"
-	"strings"
 
 	"github.com/danielfireman/deciframe-api/db"
-	sets "github.com/deckarep/golang-set"
 
 	"gopkg.in/mgo.v2"
-)
-
-const (
-	ARTISTA_ID   = 0
-	MUSICA_ID    = 1
-	ARTISTA      = 2
-	MUSICA       = 3
-	GENERO       = 4
-	POPULARIDADE = 5
-	TOM          = 6
-	SEQ_FAMOSA   = 7
-	CIFRA        = 8
+	"gopkg.in/mgo.v2/bson"
 )
 
 func main() {
@@ -34,40 +18,15 @@ func main() {
 	}
 	defer mongoDB.Close()
 
-	scanner := bufio.NewScanner(os.Stdin)
+	ms, err := db.LeCSV(os.Stdin)
+	if err != nil {
+		log.Fatal(err)
+	}
+	// Repetições violariam o índice único de id_unico_musica e seriam contadas nas sequências e nos artistas.
+	ms = db.Unicas(ms)
 	var musicas []interface{}
-	for scanner.Scan() {
-		// Pré-processando cada linha.
-		linha := scanner.Text()
-		linha = strings.Replace(linha, "\"", "", -1)
-		linha = strings.Replace(linha, "NA", "", -1)
-		dados := strings.Split(linha, ",")
-		m := &db.M{
-			IDUnicoMusica: db.IDUnicoMusica(dados[ARTISTA_ID], dados[MUSICA_ID]),
-			Artista:       dados[ARTISTA],
-			IDArtista:     dados[ARTISTA_ID],
-			ID:            dados[MUSICA_ID],
-			Nome:          dados[MUSICA],
-			Genero:        dados[GENERO],
-			Tom:           dados[TOM],
-		}
-
-		m.Popularidade, err = strconv.Atoi(strings.Replace(dados[POPULARIDADE], ".", "", -1))
-		if err != nil {
-			log.Fatal(err)
-		}
-
-		seqFTrim := strings.Trim(dados[SEQ_FAMOSA], " ")
-		if seqFTrim != "" && seqFTrim != "NA" {
-			m.SeqFamosas = strings.Split(seqFTrim, ";")
-		}
-
-		// Tratando acordes como um campo obrigatório. Não adicionando se não tiver acordes.
-		a := acordes(dados[CIFRA])
-		if len(a) > 0 {
-			m.Acordes = a
-			musicas = append(musicas, m)
-		}
+	for _, m := range ms {
+		musicas = append(musicas, m)
 	}
 
 	fmt.Printf("Inserindo %d músicas. \n", len(musicas))
@@ -112,52 +71,86 @@ func main() {
 		log.Fatalf("Erro criando índice de seq_famosas: %q", err)
 	}
 	fmt.Println("Índice de seq_famosas criado com sucesso.")
+	if err = c.EnsureIndex(mgo.Index{
+		Key:        []string{"graus"},
+		Unique:     false,
+		DropDups:   false,
+		Background: false,
+		Sparse:     true,
+	}); err != nil {
+		log.Fatalf("Erro criando índice de graus: %q", err)
+	}
+	fmt.Println("Índice de graus criado com sucesso.")
+	if err = c.EnsureIndex(mgo.Index{
+		Key:        []string{"id_artista"},
+		Unique:     false,
+		DropDups:   false,
+		Background: false,
+		Sparse:     true,
+	}); err != nil {
+		log.Fatalf("Erro criando índice de id_artista: %q", err)
+	}
+	fmt.Println("Índice de id_artista criado com sucesso.")
+	// Os campos já são normalizados (sem acentos), portanto a busca ignora acentos mesmo em versões antigas do MongoDB.
+	if err = c.EnsureIndex(mgo.Index{
+		Key:             []string{"$text:nome_busca", "$text:nome_artista_busca"},
+		Background:      false,
+		DefaultLanguage: "portuguese",
+		Weights:         map[string]int{"nome_busca": 3, "nome_artista_busca": 1},
+	}); err != nil {
+		log.Fatalf("Erro criando índice textual: %q", err)
+	}
+	fmt.Println("Índice textual criado com sucesso.")
 	if err := c.Insert(musicas...); err != nil {
 		log.Fatalf("Erro inserindo músicas: %q", err)
 	}
 	fmt.Printf("%d músicas inseridas com sucesso.\n", len(musicas))
-}
 
-func acordes(strCifra string) []string {
-	acordes := sets.NewSet()
-	cifra := limpaCifra(strCifra)
-	for _, c := range cifra {
-		acordes.Add(c)
+	cs := mongoDB.GetColecaoSequencias()
+	if err = cs.EnsureIndex(mgo.Index{
+		Key:        []string{"id_sequencia"},
+		Unique:     true,
+		DropDups:   true,
+		Background: false,
+		Sparse:     true,
+	}); err != nil {
+		log.Fatalf("Erro criando índice de id_sequencia: %q", err)
 	}
-	var result []string
-	for c := range acordes.Iter() {
-		result = append(result, c.(string))
+	fmt.Println("Índice de id_sequencia criado com sucesso.")
+	seqs := db.Sequencias(ms)
+	for _, s := range seqs {
+		if _, err := cs.Upsert(bson.M{"id_sequencia": s.ID}, s); err != nil {
+			log.Fatalf("Erro inserindo sequência %s: %q", s.ID, err)
+		}
 	}
-	return result
-}
+	fmt.Printf("%d sequências famosas inseridas com sucesso.\n", len(seqs))
 
-func limpaCifra(strCifra string) []string {
-	if strCifra == "" {
-		return []string{}
-	}
-	var cifra []string
-	rawCifra := strings.Split(strCifra, ";")
-	for _, m := range rawCifra {
-		m = strings.Trim(m, " ")
-		if len(m) != 0 {
-			if strings.Contains(m, "|") {
-				// filtra tablaturas
-				acorde := strings.Split(m, "|")[0]
-				acorde = pythonSplit(acorde)[0]
-				cifra = append(cifra, acorde)
-			} else {
-				// lida com acordes separados por espaço
-				cifra = append(cifra, pythonSplit(m)...)
-			}
+	ca := mongoDB.GetColecaoArtistas()
+	if err = ca.EnsureIndex(mgo.Index{
+		Key:        []string{"id_artista"},
+		Unique:     true,
+		DropDups:   true,
+		Background: false,
+		Sparse:     true,
+	}); err != nil {
+		log.Fatalf("Erro criando índice de artistas por id_artista: %q", err)
+	}
+	fmt.Println("Índice de artistas por id_artista criado com sucesso.")
+	if err = ca.EnsureIndex(mgo.Index{
+		Key:        []string{"nome_busca"},
+		Unique:     false,
+		DropDups:   false,
+		Background: false,
+		Sparse:     true,
+	}); err != nil {
+		log.Fatalf("Erro criando índice de nome_busca: %q", err)
+	}
+	fmt.Println("Índice de nome_busca criado com sucesso.")
+	as := db.Artistas(ms)
+	for _, a := range as {
+		if _, err := ca.Upsert(bson.M{"id_artista": a.ID}, a); err != nil {
+			log.Fatalf("Erro inserindo artista %s: %q", a.ID, err)
 		}
 	}
-	return cifra
-}
-
-// Mais perto que consegui da função split() em python.
-// A idéia é converter múltiplos espaços consecutivos em um espaço e então fazer split.
-var multiplosEspacos = regexp.MustCompile(" +")
-
-func pythonSplit(s string) []string {
-	return strings.Split(multiplosEspacos.ReplaceAllString(s, " "), " ")
+	fmt.Printf("%d artistas inseridos com sucesso.\n", len(as))
 }
@@ -0,0 +1,279 @@
+package db
+
+import (
+	"context"
+	"io"
+	"math"
+	"sort"
+	"strings"
+
+	"github.com/danielfireman/deciframe-api/model"
+	sets "github.com/deckarep/golang-set"
+)
+
+// Número de músicas percorridas entre verificações do contexto nas buscas em memória.
+const VERIFICACAO_CONTEXTO = 1024
+
+// Memoria é um Repositorio mantido inteiramente em memória, útil para executar o serviço sem MongoDB. Os dados
+// não são alterados depois de carregados, portanto as buscas podem ser feitas concorrentemente.
+type Memoria struct {
+	musicas    []*M
+	porID      map[string]*M
+	sequencias []*S
+	artistas   []*A // Ordenados por NomeBusca.
+	porArtista map[string]*A
+}
+
+// MemoriaDeCSV carrega o repositório a partir do CSV de músicas, no mesmo formato lido pelo loader.
+func MemoriaDeCSV(r io.Reader) (*Memoria, error) {
+	musicas, err := LeCSV(r)
+	if err != nil {
+		return nil, err
+	}
+	return NovaMemoria(musicas), nil
+}
+
+// NovaMemoria cria o repositório com as músicas, das quais apenas a primeira ocorrência de cada id_unico_musica é
+// mantida (veja Unicas).
+func NovaMemoria(musicas []*M) *Memoria {
+	musicas = Unicas(musicas)
+	m := &Memoria{
+		musicas:    musicas,
+		porID:      make(map[string]*M, len(musicas)),
+		sequencias: Sequencias(musicas),
+		artistas:   Artistas(musicas),
+		porArtista: make(map[string]*A),
+	}
+	for _, musica := range m.musicas {
+		m.porID[musica.IDUnicoMusica] = musica
+	}
+	sort.Stable(porNomeBusca(m.artistas))
+	for _, a := range m.artistas {
+		m.porArtista[a.ID] = a
+	}
+	return m
+}
+
+type porNomeBusca []*A
+
+func (p porNomeBusca) Len() int           { return len(p) }
+func (p porNomeBusca) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p porNomeBusca) Less(i, j int) bool { return p[i].NomeBusca < p[j].NomeBusca }
+
+func (m *Memoria) TodasMusicas(ctx context.Context) ([]*model.Musica, error) {
+	return m.filtra(ctx, nil, false, func(*M) bool { return true })
+}
+
+func (m *Memoria) BuscaMusicaPorIDUnico(ctx context.Context, idUnicoMusica string) (*model.Musica, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	musica, ok := m.porID[idUnicoMusica]
+	if !ok {
+		return nil, ErrNaoEncontrado
+	}
+	return musica.musica(), nil
+}
+
+func (m *Memoria) BuscaMusicasPorAcordes(ctx context.Context, acordes, generos []string) ([]*model.Musica, error) {
+	a := conjunto(acordes)
+	return m.filtra(ctx, generos, false, func(musica *M) bool {
+		return algumEm(musica.Acordes, a)
+	})
+}
+
+func (m *Memoria) BuscaMusicasPorTodosAcordes(ctx context.Context, acordes, generos []string) ([]*model.Musica, error) {
+	return m.filtra(ctx, generos, true, func(musica *M) bool {
+		return conjunto(musica.Acordes).IsSuperset(conjunto(acordes))
+	})
+}
+
+func (m *Memoria) BuscaMusicasPorGraus(ctx context.Context, graus, generos []string) ([]*model.Musica, error) {
+	g := conjunto(graus)
+	return m.filtra(ctx, generos, false, func(musica *M) bool {
+		return algumEm(musica.Graus, g)
+	})
+}
+
+func (m *Memoria) BuscaMusicasPorSeqFamosa(ctx context.Context, seqFamosas, generos []string) ([]*model.Musica, error) {
+	s := conjunto(seqFamosas)
+	return m.filtra(ctx, generos, true, func(musica *M) bool {
+		return algumEm(musica.SeqFamosas, s)
+	})
+}
+
+func (m *Memoria) BuscaMusicasPorArtista(ctx context.Context, idArtista string) ([]*model.Musica, error) {
+	return m.filtra(ctx, nil, true, func(musica *M) bool {
+		return musica.IDArtista == idArtista
+	})
+}
+
+func (m *Memoria) BuscaSequencias(ctx context.Context) ([]*model.Sequencia, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	var res []*model.Sequencia
+	for _, s := range m.sequencias {
+		res = append(res, s.sequencia())
+	}
+	return res, nil
+}
+
+func (m *Memoria) BuscaArtistas(ctx context.Context, prefixo string, pagina, tamanho int) ([]*model.Artista, int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	p := Normaliza(prefixo)
+	inicio, ok := pular(pagina, tamanho)
+	var res []*model.Artista
+	total := 0
+	for _, a := range m.artistas {
+		if !strings.HasPrefix(a.NomeBusca, p) {
+			continue
+		}
+		if ok && total >= inicio && len(res) < tamanho {
+			res = append(res, a.artista())
+		}
+		total++
+	}
+	return res, total, nil
+}
+
+func (m *Memoria) BuscaArtistaPorID(ctx context.Context, idArtista string) (*model.Artista, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	a, ok := m.porArtista[idArtista]
+	if !ok {
+		return nil, ErrNaoEncontrado
+	}
+	return a.artista(), nil
+}
+
+// BuscaTextual pontua cada música pelos termos da busca encontrados no nome da música (peso 3) e no nome do
+// artista (peso 1), os mesmos pesos do índice textual criado pelo loader.
+func (m *Memoria) BuscaTextual(ctx context.Context, texto string, limite int) ([]*Relevante, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	termos := strings.Fields(Normaliza(texto))
+	var res []*Relevante
+	for _, musica := range m.musicas {
+		nome, artista := conjunto(strings.Fields(musica.NomeBusca)), conjunto(strings.Fields(musica.ArtistaBusca))
+		var relevancia float64
+		for _, t := range termos {
+			if nome.Contains(t) {
+				relevancia += 3
+			}
+			if artista.Contains(t) {
+				relevancia++
+			}
+		}
+		if relevancia > 0 {
+			res = append(res, &Relevante{Musica: musica.musica(), Relevancia: relevancia})
+		}
+	}
+	sort.Stable(porRelevancia(res))
+	if len(res) > limite {
+		res = res[:limite]
+	}
+	return res, nil
+}
+
+type porRelevancia []*Relevante
+
+func (p porRelevancia) Len() int           { return len(p) }
+func (p porRelevancia) Swap(i, j int)      { p[i], p[j] = p[j], p[i] }
+func (p porRelevancia) Less(i, j int) bool { return p[i].Relevancia > p[j].Relevancia }
+
+func (m *Memoria) FrequenciaAcordes(ctx context.Context) (map[string]int, int, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, 0, err
+	}
+	freq := make(map[string]int)
+	for _, musica := range m.musicas {
+		for _, a := range musica.Acordes {
+			freq[a]++
+		}
+	}
+	return freq, len(m.musicas), nil
+}
+
+func (m *Memoria) EstatisticasGeneros(ctx context.Context, numAcordes int) ([]*model.Genero, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+	porNome := make(map[string]*model.Genero)
+	contagens := make(map[string]map[string]int)
+	popularidade := make(map[string]int)
+	var res []*model.Genero
+	for _, musica := range m.musicas {
+		g, ok := porNome[musica.Genero]
+		if !ok {
+			g = &model.Genero{Nome: musica.Genero}
+			porNome[musica.Genero] = g
+			contagens[musica.Genero] = make(map[string]int)
+			res = append(res, g)
+		}
+		g.NumMusicas++
+		popularidade[musica.Genero] += musica.Popularidade
+		for _, a := range musica.Acordes {
+			contagens[musica.Genero][a]++
+		}
+	}
+	for _, g := range res {
+		g.PopularidadeMedia = float64(popularidade[g.Nome]) / math.Max(1, float64(g.NumMusicas))
+		g.AcordesMaisFrequentes = maisUsados(contagens[g.Nome], numAcordes)
+	}
+	sort.SliceStable(res, func(i, j int) bool { return res[i].NumMusicas > res[j].NumMusicas })
+	return res, nil
+}
+
+func (m *Memoria) Ping(ctx context.Context) error {
+	return ctx.Err()
+}
+
+func (m *Memoria) Close() {}
+
+// filtra retorna as músicas que satisfazem o critério e pertencem a um dos gêneros (se algum for passado),
+// opcionalmente ordenadas da mais popular para a menos popular. O contexto é verificado a cada
+// VERIFICACAO_CONTEXTO músicas percorridas.
+func (m *Memoria) filtra(ctx context.Context, generos []string, porPopularidadeDesc bool, criterio func(*M) bool) ([]*model.Musica, error) {
+	g := conjunto(generos)
+	var encontradas []*M
+	for i, musica := range m.musicas {
+		if i%VERIFICACAO_CONTEXTO == 0 {
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+		}
+		if (len(generos) == 0 || g.Contains(musica.Genero)) && criterio(musica) {
+			encontradas = append(encontradas, musica)
+		}
+	}
+	if porPopularidadeDesc {
+		sort.Stable(porPopularidade(encontradas))
+	}
+	var res []*model.Musica
+	for _, musica := range encontradas {
+		res = append(res, musica.musica())
+	}
+	return res, nil
+}
+
+func conjunto(valores []string) sets.Set {
+	s := sets.NewThreadUnsafeSet()
+	for _, v := range valores {
+		s.Add(v)
+	}
+	return s
+}
+
+func algumEm(valores []string, s sets.Set) bool {
+	for _, v := range valores {
+		if s.Contains(v) {
+			return true
+		}
+	}
+	return false
+}
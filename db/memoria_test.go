@@ -0,0 +1,187 @@
+package db
+
+import (
+	"context"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+const csvTeste = `"legiao-urbana","tempo-perdido","Legião Urbana","Tempo Perdido","Rock","1.234","C","NA","C; G; Am; F; C; G; Am; F"
+
+"legiao-urbana","pais-e-filhos","Legião Urbana","Pais e Filhos","Rock","900","D","NA","D; A; Bm; G"
+"curta","sem-cifra","Curta","Sem Cifra","Rock","10"
+"artista-a","menor","Artista A","Menor","MPB","50","Am","NA","Am; F; C; G"
+"artista-a","sem-acordes","Artista A","Sem Acordes","MPB","5","C","NA",""
+   
+`
+
+func memoriaTeste(t *testing.T) *Memoria {
+	m, err := MemoriaDeCSV(strings.NewReader(csvTeste))
+	if err != nil {
+		t.Fatalf("MemoriaDeCSV: %q", err)
+	}
+	return m
+}
+
+// ids retorna o id_unico_musica de cada música de musicas, que pode ser []*model.Musica ou []*M.
+func ids(musicas interface{}) []string {
+	var res []string
+	v := reflect.ValueOf(musicas)
+	for i := 0; i < v.Len(); i++ {
+		res = append(res, v.Index(i).Elem().FieldByName("UniqueID").String())
+	}
+	return res
+}
+
+func ordenados(s []string) []string {
+	res := append([]string(nil), s...)
+	sort.Strings(res)
+	return res
+}
+
+func TestMemoriaDeCSV_LinhasInvalidas(t *testing.T) {
+	musicas, err := memoriaTeste(t).TodasMusicas(context.Background())
+	if err != nil {
+		t.Fatalf("TodasMusicas: %q", err)
+	}
+	want := []string{"legiao-urbana_tempo-perdido", "legiao-urbana_pais-e-filhos", "artista-a_menor"}
+	if got := ids(musicas); !reflect.DeepEqual(got, want) {
+		t.Errorf("TodasMusicas = %v, want %v", got, want)
+	}
+}
+
+func TestLeCSV_PopularidadeInvalida(t *testing.T) {
+	if _, err := LeCSV(strings.NewReader(`"a","b","A","B","Rock","muito","C","NA","C; G"`)); err == nil {
+		t.Errorf("LeCSV deveria retornar erro para popularidade inválida")
+	}
+}
+
+func TestMemoria_BuscaMusicaPorIDUnico(t *testing.T) {
+	m := memoriaTeste(t)
+	musica, err := m.BuscaMusicaPorIDUnico(context.Background(), "artista-a_menor")
+	if err != nil {
+		t.Fatalf("BuscaMusicaPorIDUnico: %q", err)
+	}
+	// Acordes e graus não têm ordem definida.
+	if got, want := ordenados(musica.Acordes), []string{"Am", "C", "F", "G"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Acordes = %v, want %v", got, want)
+	}
+	if got, want := ordenados(musica.Graus), []string{"I", "IV", "V", "VIm"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("Graus = %v, want %v", got, want)
+	}
+	if _, err := m.BuscaMusicaPorIDUnico(context.Background(), "nao_existe"); !NaoEncontrado(err) {
+		t.Errorf("BuscaMusicaPorIDUnico(\"nao_existe\") = %q, want ErrNaoEncontrado", err)
+	}
+}
+
+func TestMemoria_Buscas(t *testing.T) {
+	m := memoriaTeste(t)
+	ctx := context.Background()
+	data := []struct {
+		desc  string
+		busca func() (interface{}, error)
+		want  []string
+	}{
+		{"acordes", func() (interface{}, error) { return m.BuscaMusicasPorAcordes(ctx, []string{"Bm", "Am"}, nil) },
+			[]string{"legiao-urbana_tempo-perdido", "legiao-urbana_pais-e-filhos", "artista-a_menor"}},
+		{"acordes e gêneros", func() (interface{}, error) { return m.BuscaMusicasPorAcordes(ctx, []string{"Am"}, []string{"MPB"}) },
+			[]string{"artista-a_menor"}},
+		{"todos os acordes", func() (interface{}, error) { return m.BuscaMusicasPorTodosAcordes(ctx, []string{"C", "Am"}, nil) },
+			[]string{"legiao-urbana_tempo-perdido", "artista-a_menor"}},
+		{"graus", func() (interface{}, error) { return m.BuscaMusicasPorGraus(ctx, []string{"VIm"}, nil) },
+			[]string{"legiao-urbana_tempo-perdido", "legiao-urbana_pais-e-filhos", "artista-a_menor"}},
+		{"sequência famosa", func() (interface{}, error) { return m.BuscaMusicasPorSeqFamosa(ctx, []string{"1"}, nil) },
+			[]string{"legiao-urbana_tempo-perdido", "legiao-urbana_pais-e-filhos"}},
+		{"artista", func() (interface{}, error) { return m.BuscaMusicasPorArtista(ctx, "legiao-urbana") },
+			[]string{"legiao-urbana_tempo-perdido", "legiao-urbana_pais-e-filhos"}},
+	}
+	for _, d := range data {
+		musicas, err := d.busca()
+		if err != nil {
+			t.Errorf("%s: %q", d.desc, err)
+			continue
+		}
+		if got := ids(musicas); !reflect.DeepEqual(got, d.want) {
+			t.Errorf("%s = %v, want %v", d.desc, got, d.want)
+		}
+	}
+}
+
+func TestMemoria_ContextoCancelado(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := memoriaTeste(t).BuscaMusicasPorAcordes(ctx, []string{"C"}, nil); err != context.Canceled {
+		t.Errorf("BuscaMusicasPorAcordes com contexto cancelado = %q, want %q", err, context.Canceled)
+	}
+}
+
+func TestMemoria_BuscaArtistas(t *testing.T) {
+	m := memoriaTeste(t)
+	data := []struct {
+		prefixo         string
+		pagina, tamanho int
+		want            []string
+		total           int
+	}{
+		{"", 1, 10, []string{"artista-a", "legiao-urbana"}, 2},
+		{"", 1, 1, []string{"artista-a"}, 2},
+		{"", 2, 1, []string{"legiao-urbana"}, 2},
+		{"", 3, 1, nil, 2},
+		{"legiao", 1, 10, []string{"legiao-urbana"}, 1},
+		{"Legião", 1, 10, []string{"legiao-urbana"}, 1},
+		{"", math.MaxInt64, 100, nil, 2},
+		{"", MAX_PULAR/100 + 2, 100, nil, 2},
+	}
+	for _, d := range data {
+		artistas, total, err := m.BuscaArtistas(context.Background(), d.prefixo, d.pagina, d.tamanho)
+		if err != nil {
+			t.Errorf("BuscaArtistas(%q, %d, %d): %q", d.prefixo, d.pagina, d.tamanho, err)
+			continue
+		}
+		var got []string
+		for _, a := range artistas {
+			got = append(got, a.ID)
+		}
+		if !reflect.DeepEqual(got, d.want) || total != d.total {
+			t.Errorf("BuscaArtistas(%q, %d, %d) = (%v, %d), want (%v, %d)", d.prefixo, d.pagina, d.tamanho, got, total, d.want, d.total)
+		}
+	}
+}
+
+func TestNovaMemoria_MusicasRepetidas(t *testing.T) {
+	linha := `"legiao-urbana","tempo-perdido","Legião Urbana","Tempo Perdido","Rock","1.234","C","NA","C; G; Am; F"` + "\n"
+	m, err := MemoriaDeCSV(strings.NewReader(csvTeste + linha + linha))
+	if err != nil {
+		t.Fatalf("MemoriaDeCSV: %q", err)
+	}
+	ctx := context.Background()
+	musicas, err := m.TodasMusicas(ctx)
+	if err != nil {
+		t.Fatalf("TodasMusicas: %q", err)
+	}
+	if got, want := len(musicas), 3; got != want {
+		t.Errorf("len(TodasMusicas) = %d, want %d", got, want)
+	}
+	a, err := m.BuscaArtistaPorID(ctx, "legiao-urbana")
+	if err != nil {
+		t.Fatalf("BuscaArtistaPorID: %q", err)
+	}
+	if a.NumMusicas != 2 || a.Popularidade != 1234+900 {
+		t.Errorf("BuscaArtistaPorID = %+v, want 2 músicas com popularidade %d", a, 1234+900)
+	}
+	seqs, err := m.BuscaSequencias(ctx)
+	if err != nil {
+		t.Fatalf("BuscaSequencias: %q", err)
+	}
+	for _, s := range seqs {
+		if s.ID != "1" {
+			continue
+		}
+		if want := []string{"legiao-urbana_tempo-perdido", "legiao-urbana_pais-e-filhos"}; !reflect.DeepEqual(s.Exemplos, want) {
+			t.Errorf("Exemplos da sequência 1 = %v, want %v", s.Exemplos, want)
+		}
+	}
+}
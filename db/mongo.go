@@ -1,8 +1,11 @@
 package db
 
 import (
+	"context"
 	"fmt"
 	"net/url"
+	"regexp"
+	"time"
 
 	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
@@ -11,9 +14,15 @@ import (
 )
 
 const (
-	TabelaMusicas = "musicas"
+	TabelaMusicas    = "musicas"
+	TabelaSequencias = "sequencias"
+	TabelaArtistas   = "artistas"
 )
 
+// Menor timeout de socket usado pelas consultas com prazo, para que um prazo quase expirado não vire um timeout
+// inválido. A consulta ainda é abandonada quando o contexto expira.
+const MIN_TIMEOUT_SOCKET = 10 * time.Millisecond
+
 type M struct {
 	IDUnicoMusica string   `bson:"id_unico_musica"`
 	IDArtista     string   `bson:"id_artista"`
@@ -22,20 +31,88 @@ type M struct {
 	Artista       string   `bson:"nome_artista"`
 	Nome          string   `bson:"nome_musica"`
 	Acordes       []string `bson:"acordes"`
+	Graus         []string `bson:"graus,omitempty"` // Acordes relativos ao tom, em algarismos romanos.
+	Cifra         []string `bson:"cifra,omitempty"` // Acordes na ordem em que aparecem na música.
 	Tom           string   `bson:"tom"`
 	SeqFamosas    []string `bson:"seq_famosas,omitempty"`
 	Popularidade  int      `bson:"popularidade"`
+	NomeBusca     string   `bson:"nome_busca,omitempty"`         // Nome normalizado, usado na busca textual.
+	ArtistaBusca  string   `bson:"nome_artista_busca,omitempty"` // Nome do artista normalizado, usado na busca textual.
+	Relevancia    float64  `bson:"score,omitempty"`              // Preenchido apenas pela busca textual.
+}
+
+// Relevante é uma música encontrada pela busca textual e a relevância do texto encontrado.
+type Relevante struct {
+	*model.Musica
+	Relevancia float64
+}
+
+// S é uma sequência famosa de acordes.
+type S struct {
+	ID       string   `bson:"id_sequencia"`
+	Nome     string   `bson:"nome"`
+	Graus    []string `bson:"graus"`
+	Acordes  []string `bson:"acordes"`
+	Exemplos []string `bson:"exemplos,omitempty"`
+}
+
+func (s *S) sequencia() *model.Sequencia {
+	return &model.Sequencia{
+		ID:       s.ID,
+		Nome:     s.Nome,
+		Graus:    s.Graus,
+		Acordes:  s.Acordes,
+		Exemplos: s.Exemplos,
+	}
+}
+
+// A é um artista e os agregados de suas músicas.
+type A struct {
+	ID                string   `bson:"id_artista"`
+	Nome              string   `bson:"nome_artista"`
+	NomeBusca         string   `bson:"nome_busca"` // Nome normalizado, usado na busca por prefixo.
+	NumMusicas        int      `bson:"num_musicas"`
+	Popularidade      int      `bson:"popularidade"`
+	AcordesMaisUsados []string `bson:"acordes_mais_usados,omitempty"`
+}
+
+func (a *A) artista() *model.Artista {
+	return &model.Artista{
+		ID:                a.ID,
+		Nome:              a.Nome,
+		NumMusicas:        a.NumMusicas,
+		Popularidade:      a.Popularidade,
+		AcordesMaisUsados: a.AcordesMaisUsados,
+	}
 }
 
 func (m *M) URL() string {
 	return fmt.Sprintf("http://www.cifraclub.com.br/%s/%s", m.IDArtista, m.ID)
 }
 
+func (m *M) musica() *model.Musica {
+	return &model.Musica{
+		IDArtista:    m.IDArtista,
+		UniqueID:     m.IDUnicoMusica,
+		Genero:       m.Genero,
+		ID:           m.ID,
+		Artista:      m.Artista,
+		Nome:         m.Nome,
+		URL:          m.URL(),
+		Popularidade: m.Popularidade,
+		Cifra:        m.Cifra,
+		SeqFamosas:   m.SeqFamosas,
+		Tom:          m.Tom,
+		Acordes:      m.Acordes,
+		Graus:        m.Graus,
+	}
+}
+
 func IDUnicoMusica(artista, id string) string {
 	return fmt.Sprintf("%s_%s", artista, id)
 }
 func NaoEncontrado(err error) bool {
-	return mgo.ErrNotFound == err
+	return mgo.ErrNotFound == err || ErrNaoEncontrado == err
 }
 
 type DB struct {
@@ -43,60 +120,295 @@ type DB struct {
 	name    string
 }
 
-func (db *DB) BuscaMusicaPorIDUnico(idUnicoMusica string) (*model.Musica, error) {
+// executa roda f sobre uma cópia da sessão, retornando ctx.Err() assim que o contexto for cancelado ou expirar. O
+// mgo não aceita contextos, então o prazo do contexto também limita o timeout do socket da cópia, garantindo que
+// uma consulta abandonada não continue rodando indefinidamente.
+func (db *DB) executa(ctx context.Context, tabela string, f func(c *mgo.Collection) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	var timeout time.Duration
+	if prazo, ok := ctx.Deadline(); ok {
+		// Para o mgo, timeout zero significa sem timeout.
+		if timeout = time.Until(prazo); timeout <= 0 {
+			return context.DeadlineExceeded
+		}
+		if timeout < MIN_TIMEOUT_SOCKET {
+			timeout = MIN_TIMEOUT_SOCKET
+		}
+	}
 	session := db.session.Copy()
-	defer session.Close()
-	c := session.DB(db.name).C(TabelaMusicas)
+	if timeout > 0 {
+		session.SetSocketTimeout(timeout)
+	}
+	fim := make(chan error, 1)
+	go func() {
+		defer session.Close()
+		fim <- f(session.DB(db.name).C(tabela))
+	}()
+	select {
+	case err := <-fim:
+		return err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
 
-	m := M{}
-	if err := c.Find(bson.M{"id_unico_musica": idUnicoMusica}).One(&m); err != nil {
+// buscaMusicas executa a consulta construída por consulta na coleção de músicas.
+func (db *DB) buscaMusicas(ctx context.Context, consulta func(c *mgo.Collection) *mgo.Query) ([]*model.Musica, error) {
+	var res []*model.Musica
+	err := db.executa(ctx, TabelaMusicas, func(c *mgo.Collection) error {
+		var err error
+		res, err = executaConsulta(consulta(c))
+		return err
+	})
+	if err != nil {
 		return nil, err
 	}
+	return res, nil
+}
 
-	return &model.Musica{
-		IDArtista:  m.IDArtista,
-		UniqueID:   m.IDUnicoMusica,
-		Genero:     m.Genero,
-		ID:         m.ID,
-		Artista:    m.Artista,
-		Nome:       m.Nome,
-		URL:        m.URL(),
-		SeqFamosas: m.SeqFamosas,
-		Tom:        m.Tom,
-		Acordes:    m.Acordes,
-	}, nil
+// TodasMusicas retorna todas as músicas da coleção.
+func (db *DB) TodasMusicas(ctx context.Context) ([]*model.Musica, error) {
+	return db.buscaMusicas(ctx, func(c *mgo.Collection) *mgo.Query {
+		return c.Find(nil)
+	})
 }
 
-func (db *DB) BuscaMusicasPorAcordes(acordes, generos []string) ([]*model.Musica, error) {
-	session := db.session.Copy()
-	defer session.Close()
-	c := session.DB(db.name).C(TabelaMusicas)
-	if len(generos) == 0 {
-		return db.executaConsulta(c.Find(bson.M{"acordes": bson.M{"$in": acordes}}).Hint("acordes"))
+func (db *DB) BuscaMusicaPorIDUnico(ctx context.Context, idUnicoMusica string) (*model.Musica, error) {
+	m := M{}
+	if err := db.executa(ctx, TabelaMusicas, func(c *mgo.Collection) error {
+		return c.Find(bson.M{"id_unico_musica": idUnicoMusica}).One(&m)
+	}); err != nil {
+		return nil, err
 	}
-	return db.executaConsulta(
-		c.Find(bson.M{
+	return m.musica(), nil
+}
+
+func (db *DB) BuscaMusicasPorAcordes(ctx context.Context, acordes, generos []string) ([]*model.Musica, error) {
+	return db.buscaMusicas(ctx, func(c *mgo.Collection) *mgo.Query {
+		if len(generos) == 0 {
+			return c.Find(bson.M{"acordes": bson.M{"$in": acordes}}).Hint("acordes")
+		}
+		return c.Find(bson.M{
 			"acordes": bson.M{"$in": acordes},
 			"genero":  bson.M{"$in": generos},
-		}).Hint("acordes").Hint("genero"))
+		}).Hint("acordes").Hint("genero")
+	})
 }
 
-func (db *DB) BuscaMusicasPorSeqFamosa(seqFamosas, generos []string) ([]*model.Musica, error) {
-	session := db.session.Copy()
-	defer session.Close()
-	c := session.DB(db.name).C(TabelaMusicas)
-	if len(generos) == 0 {
-		return db.executaConsulta(
-			c.Find(bson.M{"seq_famosas": bson.M{"$in": seqFamosas}}).Sort("-popularidade").Hint("seq_famosas"))
-	}
-	return db.executaConsulta(
-		c.Find(bson.M{
+func (db *DB) BuscaMusicasPorSeqFamosa(ctx context.Context, seqFamosas, generos []string) ([]*model.Musica, error) {
+	return db.buscaMusicas(ctx, func(c *mgo.Collection) *mgo.Query {
+		if len(generos) == 0 {
+			return c.Find(bson.M{"seq_famosas": bson.M{"$in": seqFamosas}}).Sort("-popularidade").Hint("seq_famosas")
+		}
+		return c.Find(bson.M{
 			"seq_famosas": bson.M{"$in": seqFamosas},
 			"genero":      bson.M{"$in": generos},
-		}).Sort("-popularidade").Hint("seq_famosas").Hint("genero"))
+		}).Sort("-popularidade").Hint("seq_famosas").Hint("genero")
+	})
+}
+
+// BuscaMusicasPorTodosAcordes retorna as músicas que contém todos os acordes passados, das mais populares para as
+// menos populares.
+func (db *DB) BuscaMusicasPorTodosAcordes(ctx context.Context, acordes, generos []string) ([]*model.Musica, error) {
+	return db.buscaMusicas(ctx, func(c *mgo.Collection) *mgo.Query {
+		if len(generos) == 0 {
+			return c.Find(bson.M{"acordes": bson.M{"$all": acordes}}).Sort("-popularidade").Hint("acordes")
+		}
+		return c.Find(bson.M{
+			"acordes": bson.M{"$all": acordes},
+			"genero":  bson.M{"$in": generos},
+		}).Sort("-popularidade").Hint("acordes").Hint("genero")
+	})
+}
+
+func (db *DB) BuscaMusicasPorGraus(ctx context.Context, graus, generos []string) ([]*model.Musica, error) {
+	return db.buscaMusicas(ctx, func(c *mgo.Collection) *mgo.Query {
+		if len(generos) == 0 {
+			return c.Find(bson.M{"graus": bson.M{"$in": graus}}).Hint("graus")
+		}
+		return c.Find(bson.M{
+			"graus":  bson.M{"$in": graus},
+			"genero": bson.M{"$in": generos},
+		}).Hint("graus").Hint("genero")
+	})
+}
+
+// FrequenciaAcordes retorna em quantas músicas cada acorde aparece e o total de músicas da coleção.
+func (db *DB) FrequenciaAcordes(ctx context.Context) (map[string]int, int, error) {
+	freq := make(map[string]int)
+	var total int
+	err := db.executa(ctx, TabelaMusicas, func(c *mgo.Collection) error {
+		var err error
+		if total, err = c.Count(); err != nil {
+			return err
+		}
+		iter := c.Pipe([]bson.M{
+			{"$unwind": "$acordes"},
+			{"$group": bson.M{"_id": "$acordes", "n": bson.M{"$sum": 1}}},
+		}).AllowDiskUse().Iter()
+		defer iter.Close()
+		var r struct {
+			Acorde string `bson:"_id"`
+			N      int    `bson:"n"`
+		}
+		for iter.Next(&r) {
+			freq[r.Acorde] = r.N
+		}
+		return iter.Err()
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return freq, total, nil
+}
+
+func (db *DB) BuscaSequencias(ctx context.Context) ([]*model.Sequencia, error) {
+	var seqs []S
+	if err := db.executa(ctx, TabelaSequencias, func(c *mgo.Collection) error {
+		return c.Find(nil).Sort("id_sequencia").All(&seqs)
+	}); err != nil {
+		return nil, err
+	}
+	var res []*model.Sequencia
+	for _, s := range seqs {
+		res = append(res, s.sequencia())
+	}
+	return res, nil
+}
+
+// BuscaArtistas retorna uma página de artistas cujo nome começa com o prefixo passado (ignorando caixa e acentos),
+// em ordem alfabética, e o número total desses artistas.
+func (db *DB) BuscaArtistas(ctx context.Context, prefixo string, pagina, tamanho int) ([]*model.Artista, int, error) {
+	query := bson.M{}
+	if p := Normaliza(prefixo); p != "" {
+		query["nome_busca"] = bson.RegEx{Pattern: "^" + regexp.QuoteMeta(p)}
+	}
+	var artistas []A
+	var total int
+	if err := db.executa(ctx, TabelaArtistas, func(c *mgo.Collection) error {
+		var err error
+		if total, err = c.Find(query).Count(); err != nil {
+			return err
+		}
+		inicio, ok := pular(pagina, tamanho)
+		if !ok {
+			return nil
+		}
+		return c.Find(query).Sort("nome_busca").Skip(inicio).Limit(tamanho).All(&artistas)
+	}); err != nil {
+		return nil, 0, err
+	}
+	var res []*model.Artista
+	for _, a := range artistas {
+		res = append(res, a.artista())
+	}
+	return res, total, nil
 }
 
-func (db *DB) executaConsulta(q *mgo.Query) ([]*model.Musica, error) {
+func (db *DB) BuscaArtistaPorID(ctx context.Context, idArtista string) (*model.Artista, error) {
+	a := A{}
+	if err := db.executa(ctx, TabelaArtistas, func(c *mgo.Collection) error {
+		return c.Find(bson.M{"id_artista": idArtista}).One(&a)
+	}); err != nil {
+		return nil, err
+	}
+	return a.artista(), nil
+}
+
+// BuscaMusicasPorArtista retorna as músicas do artista, das mais populares para as menos populares.
+func (db *DB) BuscaMusicasPorArtista(ctx context.Context, idArtista string) ([]*model.Musica, error) {
+	return db.buscaMusicas(ctx, func(c *mgo.Collection) *mgo.Query {
+		return c.Find(bson.M{"id_artista": idArtista}).Sort("-popularidade").Hint("id_artista")
+	})
+}
+
+// EstatisticasGeneros retorna todos os gêneros da coleção de músicas, com o número de músicas, a popularidade média
+// e os numAcordes acordes mais frequentes de cada um. Os gêneros são ordenados pelo número de músicas.
+func (db *DB) EstatisticasGeneros(ctx context.Context, numAcordes int) ([]*model.Genero, error) {
+	var generos []struct {
+		Nome              string  `bson:"_id"`
+		NumMusicas        int     `bson:"num_musicas"`
+		PopularidadeMedia float64 `bson:"popularidade_media"`
+	}
+	acordes := make(map[string][]string)
+	err := db.executa(ctx, TabelaMusicas, func(c *mgo.Collection) error {
+		if err := c.Pipe([]bson.M{
+			{"$group": bson.M{
+				"_id":                "$genero",
+				"num_musicas":        bson.M{"$sum": 1},
+				"popularidade_media": bson.M{"$avg": "$popularidade"},
+			}},
+			{"$sort": bson.M{"num_musicas": -1}},
+		}).All(&generos); err != nil {
+			return err
+		}
+
+		// Contagem de acordes por gênero, já ordenada da mais frequente para a menos frequente.
+		iter := c.Pipe([]bson.M{
+			{"$unwind": "$acordes"},
+			{"$group": bson.M{
+				"_id": bson.M{"genero": "$genero", "acorde": "$acordes"},
+				"n":   bson.M{"$sum": 1},
+			}},
+			{"$sort": bson.M{"n": -1}},
+		}).AllowDiskUse().Iter()
+		defer iter.Close()
+		var r struct {
+			ID struct {
+				Genero string `bson:"genero"`
+				Acorde string `bson:"acorde"`
+			} `bson:"_id"`
+		}
+		for iter.Next(&r) {
+			if len(acordes[r.ID.Genero]) < numAcordes {
+				acordes[r.ID.Genero] = append(acordes[r.ID.Genero], r.ID.Acorde)
+			}
+		}
+		return iter.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var res []*model.Genero
+	for _, g := range generos {
+		res = append(res, &model.Genero{
+			Nome:                  g.Nome,
+			NumMusicas:            g.NumMusicas,
+			PopularidadeMedia:     g.PopularidadeMedia,
+			AcordesMaisFrequentes: acordes[g.Nome],
+		})
+	}
+	return res, nil
+}
+
+// BuscaTextual procura o texto (ignorando caixa e acentos) nos nomes das músicas e artistas, retornando no máximo
+// limite músicas, das mais relevantes para as menos relevantes.
+func (db *DB) BuscaTextual(ctx context.Context, texto string, limite int) ([]*Relevante, error) {
+	var res []*Relevante
+	err := db.executa(ctx, TabelaMusicas, func(c *mgo.Collection) error {
+		iter := c.Find(bson.M{"$text": bson.M{"$search": Normaliza(texto)}}).
+			Select(bson.M{"score": bson.M{"$meta": "textScore"}}).
+			Sort("$textScore:score").
+			Limit(limite).
+			Iter()
+		defer iter.Close()
+		m := &M{}
+		for iter.Next(m) {
+			res = append(res, &Relevante{Musica: m.musica(), Relevancia: m.Relevancia})
+			m = &M{}
+		}
+		return iter.Err()
+	})
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+func executaConsulta(q *mgo.Query) ([]*model.Musica, error) {
 	iter := q.Iter()
 	defer iter.Close()
 
@@ -108,19 +420,7 @@ func (db *DB) executaConsulta(q *mgo.Query) ([]*model.Musica, error) {
 				return nil, iter.Err()
 			}
 		}
-		res = append(res, &model.Musica{
-			IDArtista:    m.IDArtista,
-			UniqueID:     m.IDUnicoMusica,
-			Genero:       m.Genero,
-			ID:           m.ID,
-			Artista:      m.Artista,
-			Nome:         m.Nome,
-			URL:          m.URL(),
-			SeqFamosas:   m.SeqFamosas,
-			Tom:          m.Tom,
-			Acordes:      m.Acordes,
-			Popularidade: m.Popularidade,
-		})
+		res = append(res, m.musica())
 	}
 	return res, nil
 }
@@ -129,6 +429,20 @@ func (db *DB) GetColecaoMusicas() *mgo.Collection {
 	return db.session.DB(db.name).C(TabelaMusicas)
 }
 
+func (db *DB) GetColecaoSequencias() *mgo.Collection {
+	return db.session.DB(db.name).C(TabelaSequencias)
+}
+
+func (db *DB) GetColecaoArtistas() *mgo.Collection {
+	return db.session.DB(db.name).C(TabelaArtistas)
+}
+
+func (db *DB) Ping(ctx context.Context) error {
+	return db.executa(ctx, TabelaMusicas, func(c *mgo.Collection) error {
+		return c.Database.Session.Ping()
+	})
+}
+
 func (db *DB) Close() {
 	db.session.Close()
 }
@@ -0,0 +1,17 @@
+package db
+
+import "strings"
+
+var semAcentos = strings.NewReplacer(
+	"á", "a", "à", "a", "â", "a", "ã", "a", "ä", "a",
+	"é", "e", "è", "e", "ê", "e", "ë", "e",
+	"í", "i", "ì", "i", "î", "i", "ï", "i",
+	"ó", "o", "ò", "o", "ô", "o", "õ", "o", "ö", "o",
+	"ú", "u", "ù", "u", "û", "u", "ü", "u",
+	"ç", "c", "ñ", "n",
+)
+
+// Normaliza prepara nomes para busca: caixa baixa, sem acentos e sem espaços nas extremidades.
+func Normaliza(s string) string {
+	return semAcentos.Replace(strings.ToLower(strings.TrimSpace(s)))
+}
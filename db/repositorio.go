@@ -0,0 +1,53 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"math"
+
+	"github.com/danielfireman/deciframe-api/model"
+)
+
+// ErrNaoEncontrado é retornado pelas implementações de Repositorio quando o registro buscado não existe. Use
+// NaoEncontrado para verificar, pois a implementação MongoDB retorna o erro do mgo.
+var ErrNaoEncontrado = errors.New("registro não encontrado")
+
+// Repositorio abstrai o armazenamento das músicas. DB é a implementação sobre o MongoDB e Memoria é a
+// implementação em memória, carregada a partir do mesmo CSV usado pelo loader. Todas as buscas recebem o contexto da
+// requisição e retornam o erro do contexto (context.Canceled ou context.DeadlineExceeded) se ele terminar antes.
+type Repositorio interface {
+	TodasMusicas(ctx context.Context) ([]*model.Musica, error)
+	BuscaMusicaPorIDUnico(ctx context.Context, idUnicoMusica string) (*model.Musica, error)
+	BuscaMusicasPorAcordes(ctx context.Context, acordes, generos []string) ([]*model.Musica, error)
+	BuscaMusicasPorTodosAcordes(ctx context.Context, acordes, generos []string) ([]*model.Musica, error)
+	BuscaMusicasPorGraus(ctx context.Context, graus, generos []string) ([]*model.Musica, error)
+	BuscaMusicasPorSeqFamosa(ctx context.Context, seqFamosas, generos []string) ([]*model.Musica, error)
+	BuscaMusicasPorArtista(ctx context.Context, idArtista string) ([]*model.Musica, error)
+	BuscaSequencias(ctx context.Context) ([]*model.Sequencia, error)
+	BuscaArtistas(ctx context.Context, prefixo string, pagina, tamanho int) ([]*model.Artista, int, error)
+	BuscaArtistaPorID(ctx context.Context, idArtista string) (*model.Artista, error)
+	BuscaTextual(ctx context.Context, texto string, limite int) ([]*Relevante, error)
+	FrequenciaAcordes(ctx context.Context) (map[string]int, int, error)
+	EstatisticasGeneros(ctx context.Context, numAcordes int) ([]*model.Genero, error)
+
+	// Ping verifica se o armazenamento está acessível.
+	Ping(ctx context.Context) error
+	Close()
+}
+
+var (
+	_ Repositorio = (*DB)(nil)
+	_ Repositorio = (*Memoria)(nil)
+)
+
+// MAX_PULAR é o maior número de registros que precedem uma página: o MongoDB recebe o skip como inteiro de 32 bits.
+const MAX_PULAR = math.MaxInt32
+
+// pular retorna quantos registros precedem a página (começando de 1) de tamanho registros. Retorna false se esse
+// número estourar MAX_PULAR, caso em que a página está certamente além do fim dos resultados.
+func pular(pagina, tamanho int) (int, bool) {
+	if pagina < 1 || tamanho < 1 || pagina-1 > MAX_PULAR/tamanho {
+		return 0, false
+	}
+	return (pagina - 1) * tamanho, true
+}
@@ -0,0 +1,135 @@
+// Package erro define o formato único das respostas de erro da API: um envelope JSON com um código estável, a
+// mensagem em português e em inglês e o identificador da requisição, que também é devolvido no cabeçalho
+// X-Request-Id e permite relacionar a resposta aos logs do serviço.
+package erro
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"net/http"
+)
+
+// Cabeçalho com o identificador da requisição. Identificadores recebidos com mais de MAX_TAM_ID caracteres são
+// substituídos por um gerado pelo serviço.
+const (
+	CABECALHO_ID = "X-Request-Id"
+	MAX_TAM_ID   = 128
+)
+
+// Códigos de erro. Os clientes devem se basear no código, e não nas mensagens, que podem mudar.
+const (
+	PARAMETRO_INVALIDO   = "parametro_invalido"
+	NAO_ENCONTRADO       = "nao_encontrado"
+	ROTA_INEXISTENTE     = "rota_inexistente"
+	METODO_NAO_PERMITIDO = "metodo_nao_permitido"
+	MUITAS_REQUISICOES   = "muitas_requisicoes"
+	SOBRECARREGADO       = "sobrecarregado"
+	PRAZO_EXPIRADO       = "prazo_expirado"
+	INTERNO              = "interno"
+)
+
+// Erro é um erro a ser respondido ao cliente.
+type Erro struct {
+	Status       int    `json:"-"`
+	Codigo       string `json:"codigo"`
+	Mensagem     string `json:"mensagem"` // Em português.
+	Message      string `json:"message"`  // Em inglês.
+	IDRequisicao string `json:"id_requisicao,omitempty"`
+}
+
+func (e *Erro) Error() string {
+	return e.Mensagem
+}
+
+// Resposta é o envelope das respostas de erro.
+type Resposta struct {
+	Erro *Erro `json:"erro"`
+}
+
+func Novo(status int, codigo, mensagem, message string) *Erro {
+	return &Erro{Status: status, Codigo: codigo, Mensagem: mensagem, Message: message}
+}
+
+// ParametroInvalido indica que um parâmetro da requisição é inválido. As mensagens devem dizer qual e por quê.
+func ParametroInvalido(mensagem, message string) *Erro {
+	return Novo(http.StatusBadRequest, PARAMETRO_INVALIDO, mensagem, message)
+}
+
+// NaoEncontrado indica que o recurso requisitado não existe.
+func NaoEncontrado(mensagem, message string) *Erro {
+	return Novo(http.StatusNotFound, NAO_ENCONTRADO, mensagem, message)
+}
+
+// Interno converte um erro do repositório, do cache ou da serialização da resposta: 504 se o contexto da
+// requisição terminou (prazo expirado ou cliente desconectado), 500 caso contrário. O erro original não é
+// exposto ao cliente, deve ser registrado no log por quem o recebeu.
+func Interno(err error) *Erro {
+	if err == context.DeadlineExceeded || err == context.Canceled {
+		return Novo(http.StatusGatewayTimeout, PRAZO_EXPIRADO,
+			"A requisição não foi concluída dentro do prazo.",
+			"The request did not complete in time.")
+	}
+	return Novo(http.StatusInternalServerError, INTERNO,
+		"Erro interno do servidor.",
+		"Internal server error.")
+}
+
+// Escreve responde a requisição com o erro, no envelope padrão.
+func Escreve(w http.ResponseWriter, r *http.Request, e *Erro) {
+	resp := *e
+	resp.IDRequisicao = r.Header.Get(CABECALHO_ID)
+	b, err := json.Marshal(Resposta{Erro: &resp})
+	if err != nil {
+		log.Printf("Erro serializando resposta de erro [%s]: '%q'\n", r.URL.String(), err)
+		w.WriteHeader(e.Status)
+		return
+	}
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", "application/json; charset=utf-8")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(e.Status)
+	w.Write(b)
+}
+
+// ComIDRequisicao garante que toda requisição tenha um identificador, gerando um quando o cliente (ou o
+// balanceador de carga) não envia o cabeçalho X-Request-Id, e o devolve no mesmo cabeçalho da resposta.
+func ComIDRequisicao(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(CABECALHO_ID)
+		if id == "" || len(id) > MAX_TAM_ID {
+			id = novoID()
+			r.Header.Set(CABECALHO_ID, id)
+		}
+		w.Header().Set(CABECALHO_ID, id)
+		h.ServeHTTP(w, r)
+	})
+}
+
+// RotaInexistente responde as requisições que não correspondem a nenhuma rota.
+func RotaInexistente() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Escreve(w, r, Novo(http.StatusNotFound, ROTA_INEXISTENTE,
+			"Rota inexistente: "+r.URL.Path,
+			"No such route: "+r.URL.Path))
+	})
+}
+
+// MetodoNaoPermitido responde as requisições a rotas existentes com um método não suportado.
+func MetodoNaoPermitido() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Escreve(w, r, Novo(http.StatusMethodNotAllowed, METODO_NAO_PERMITIDO,
+			"Método não permitido: "+r.Method,
+			"Method not allowed: "+r.Method))
+	})
+}
+
+func novoID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		log.Printf("Erro gerando identificador da requisição: %q", err)
+	}
+	return hex.EncodeToString(b)
+}
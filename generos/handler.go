@@ -0,0 +1,75 @@
+package generos
+
+import (
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/danielfireman/deciframe-api/cache"
+	"github.com/danielfireman/deciframe-api/db"
+	"github.com/danielfireman/deciframe-api/erro"
+	"github.com/danielfireman/deciframe-api/model"
+	"github.com/danielfireman/deciframe-api/resposta"
+	"github.com/danielfireman/deciframe-api/telemetria"
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	CHAVE_CACHE            = "generos"
+	NUM_ACORDES_FREQUENTES = 10
+	EXPIRACAO              = 6 * time.Hour
+)
+
+type HandlerFactory struct {
+	mon       telemetria.Telemetria
+	db        db.Repositorio
+	cache     cache.Cache
+	expiracao time.Duration
+}
+
+// FabricaDeTratadores cria o tratador de /generos. As estatísticas ficam no cache por expiracao (EXPIRACAO se não
+// for positiva).
+func FabricaDeTratadores(db db.Repositorio, cache cache.Cache, expiracao time.Duration, mon telemetria.Telemetria) *HandlerFactory {
+	if expiracao <= 0 {
+		expiracao = EXPIRACAO
+	}
+	return &HandlerFactory{
+		mon:       mon,
+		db:        db,
+		cache:     cache,
+		expiracao: expiracao,
+	}
+}
+
+// GetHandler lista todos os gêneros com suas estatísticas. Os valores retornados são os aceitos pelo parâmetro
+// generos de /similares.
+func (s *HandlerFactory) GetHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		txn := s.mon.IniciaTransacao("generos", w, r)
+		defer txn.Fim()
+
+		var generos []*model.Genero
+		buscaCacheSeg := txn.Segmento("busca_cache")
+		err := s.cache.Get(r.Context(), CHAVE_CACHE, &generos)
+		buscaCacheSeg.Fim()
+		txn.Cache(err == nil)
+		if err != nil {
+			if err != cache.ErrCacheMiss {
+				log.Printf("Erro buscando no cache: %q", err)
+			}
+			estatisticasSeg := txn.Segmento("estatisticas_generos")
+			generos, err = s.db.EstatisticasGeneros(r.Context(), NUM_ACORDES_FREQUENTES)
+			estatisticasSeg.Fim()
+			if err != nil {
+				log.Printf("Erro processando request [%s]: '%q'\n", r.URL.String(), err)
+				erro.Escreve(txn, r, erro.Interno(err))
+				return
+			}
+			if err := s.cache.Set(r.Context(), CHAVE_CACHE, generos, s.expiracao); err != nil {
+				log.Printf("Erro colocando no cache: %q", err)
+			}
+		}
+
+		resposta.JSON(txn, r, generos)
+	}
+}
@@ -0,0 +1,37 @@
+package indice
+
+import "math/bits"
+
+// Bitset é um conjunto de inteiros não negativos, usado como lista de postagens (ids das músicas que contém um
+// acorde ou pertencem a um gênero).
+type Bitset []uint64
+
+func NovoBitset(tamanho int) Bitset {
+	return make(Bitset, (tamanho+63)/64)
+}
+
+func (b Bitset) Adiciona(i int) {
+	b[i/64] |= 1 << uint(i%64)
+}
+
+func (b Bitset) Contem(i int) bool {
+	return i/64 < len(b) && b[i/64]&(1<<uint(i%64)) != 0
+}
+
+// Uniao acumula em b os elementos de o. Ambos devem ter o mesmo tamanho.
+func (b Bitset) Uniao(o Bitset) {
+	for i := range b {
+		b[i] |= o[i]
+	}
+}
+
+// ParaCada chama f para cada elemento do conjunto, em ordem crescente.
+func (b Bitset) ParaCada(f func(i int)) {
+	for p, palavra := range b {
+		for palavra != 0 {
+			bit := bits.TrailingZeros64(palavra)
+			f(p*64 + bit)
+			palavra &= palavra - 1
+		}
+	}
+}
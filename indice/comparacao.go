@@ -0,0 +1,98 @@
+package indice
+
+import (
+	"math"
+	"sort"
+
+	sets "github.com/deckarep/golang-set"
+)
+
+// Comparacao resume a comparação entre os acordes de uma consulta e os de uma música: tamanhos dos conjuntos e da
+// interseção, simples e ponderados pelos pesos IDF dos acordes.
+type Comparacao struct {
+	Intersecao int
+	Consulta   int
+	Musica     int
+
+	PesoIntersecao float64
+	PesoConsulta   float64
+	PesoMusica     float64
+}
+
+// Diferenca é o número de acordes da música que não estão na consulta.
+func (c Comparacao) Diferenca() int {
+	return c.Musica - c.Intersecao
+}
+
+// PesosIDF associa a cada acorde o inverso (logarítmico) de sua frequência no catálogo, de forma que acordes raros
+// pesam mais que acordes comuns como C ou G. Um *PesosIDF nil representa a ausência de pesos.
+type PesosIDF struct {
+	pesos map[string]float64
+	total int // Número de músicas do catálogo.
+}
+
+// NovosPesosIDF calcula os pesos a partir do número de músicas em que cada acorde aparece e do número total de
+// músicas do catálogo.
+func NovosPesosIDF(freq map[string]int, total int) *PesosIDF {
+	p := &PesosIDF{pesos: make(map[string]float64, len(freq)), total: total}
+	for a, n := range freq {
+		p.pesos[a] = math.Log(float64(1+total) / float64(1+n))
+	}
+	return p
+}
+
+func (p *PesosIDF) Peso(acorde string) float64 {
+	if w, ok := p.pesos[acorde]; ok {
+		return w
+	}
+	// Acordes que não estão no catálogo são os mais raros possíveis, como se aparecessem em nenhuma música.
+	return math.Log(float64(1 + p.total))
+}
+
+// Escala retorna uma cópia dos pesos com o peso de cada acorde de fatores multiplicado pelo fator correspondente.
+// Sem fatores, retorna os próprios pesos.
+func (p *PesosIDF) Escala(fatores map[string]float64) *PesosIDF {
+	if len(fatores) == 0 || p == nil {
+		return p
+	}
+	escalados := &PesosIDF{pesos: make(map[string]float64, len(p.pesos)+len(fatores)), total: p.total}
+	for a, w := range p.pesos {
+		escalados.pesos[a] = w
+	}
+	for a, f := range fatores {
+		escalados.pesos[a] = p.Peso(a) * f
+	}
+	return escalados
+}
+
+// soma soma os pesos dos acordes do conjunto em ordem alfabética. Como a soma de ponto flutuante depende da ordem,
+// percorrer o conjunto diretamente (em ordem aleatória) faria a mesma música ter pontuações ligeiramente
+// diferentes a cada consulta, e os empates não chegariam aos critérios de desempate.
+func (p *PesosIDF) soma(s sets.Set) float64 {
+	if p == nil {
+		return 0
+	}
+	acordes := make([]string, 0, s.Cardinality())
+	for a := range s.Iter() {
+		acordes = append(acordes, a.(string))
+	}
+	sort.Strings(acordes)
+	var soma float64
+	for _, a := range acordes {
+		soma += p.Peso(a)
+	}
+	return soma
+}
+
+// Compara calcula a Comparacao entre dois conjuntos de acordes. Se pesos for nil, os campos ponderados ficam zerados.
+func Compara(consulta, musica sets.Set, pesos *PesosIDF) Comparacao {
+	inter := musica.Intersect(consulta)
+	return Comparacao{
+		Intersecao:     inter.Cardinality(),
+		Consulta:       consulta.Cardinality(),
+		Musica:         musica.Cardinality(),
+		PesoIntersecao: pesos.soma(inter),
+		PesoConsulta:   pesos.soma(consulta),
+		PesoMusica:     pesos.soma(musica),
+	}
+}
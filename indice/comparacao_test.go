@@ -0,0 +1,59 @@
+package indice
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	sets "github.com/deckarep/golang-set"
+)
+
+func conjunto(acordes []string) sets.Set {
+	s := sets.NewThreadUnsafeSet()
+	for _, a := range acordes {
+		s.Add(a)
+	}
+	return s
+}
+
+func TestCompara_Deterministica(t *testing.T) {
+	freq := map[string]int{"C": 90, "G": 85, "Am": 70, "F": 65, "D": 40, "Em": 35, "Bm": 12, "F#m": 7, "C#m7(b5)": 1}
+	pesos := NovosPesosIDF(freq, 100)
+	consulta := []string{"C", "G", "Am", "F", "D", "Em"}
+	musica := []string{"G", "D", "Em", "C", "Bm", "F#m", "C#m7(b5)", "Am"}
+	r := rand.New(rand.NewSource(1))
+	want := Compara(conjunto(consulta), conjunto(musica), pesos)
+	for i := 0; i < 100; i++ {
+		// Conjuntos novos, montados em outra ordem, a cada iteração.
+		r.Shuffle(len(consulta), func(i, j int) { consulta[i], consulta[j] = consulta[j], consulta[i] })
+		r.Shuffle(len(musica), func(i, j int) { musica[i], musica[j] = musica[j], musica[i] })
+		if got := Compara(conjunto(consulta), conjunto(musica), pesos); got != want {
+			t.Fatalf("Compara = %+v, want %+v", got, want)
+		}
+	}
+}
+
+func TestCompara(t *testing.T) {
+	pesos := NovosPesosIDF(map[string]int{"C": 3, "G": 1}, 3)
+	got := Compara(conjunto([]string{"C", "G", "X"}), conjunto([]string{"C", "Am"}), pesos)
+	if got.Intersecao != 1 || got.Consulta != 3 || got.Musica != 2 || got.Diferenca() != 1 {
+		t.Errorf("Compara = %+v", got)
+	}
+	// C aparece em todas as músicas; G em uma; X e Am em nenhuma.
+	if want := math.Log(4.0 / 4.0); got.PesoIntersecao != want {
+		t.Errorf("PesoIntersecao = %v, want %v", got.PesoIntersecao, want)
+	}
+	if want := math.Log(4.0/4.0) + math.Log(4.0/2.0) + math.Log(4.0); math.Abs(got.PesoConsulta-want) > 1e-12 {
+		t.Errorf("PesoConsulta = %v, want %v", got.PesoConsulta, want)
+	}
+	if want := math.Log(4.0) + math.Log(4.0/4.0); math.Abs(got.PesoMusica-want) > 1e-12 {
+		t.Errorf("PesoMusica = %v, want %v", got.PesoMusica, want)
+	}
+}
+
+func TestCompara_SemPesos(t *testing.T) {
+	got := Compara(conjunto([]string{"C", "G"}), conjunto([]string{"C"}), nil)
+	if got.PesoIntersecao != 0 || got.PesoConsulta != 0 || got.PesoMusica != 0 {
+		t.Errorf("Compara sem pesos = %+v, want pesos zerados", got)
+	}
+}
@@ -0,0 +1,51 @@
+package indice
+
+import sets "github.com/deckarep/golang-set"
+
+// Filtro restringe as músicas de uma busca pelos seus acordes, por exemplo para encontrar músicas que usem apenas
+// acordes do repertório do músico.
+type Filtro struct {
+	Obrigatorios []string // Acordes que a música deve conter.
+	Proibidos    []string // Acordes que a música não pode conter.
+	MaxNovos     *int     // Se não for nil, número máximo de acordes distintos da música fora da consulta.
+}
+
+// Aceita verifica se a música satisfaz o filtro. Os acordes novos são os da música que não estão na consulta.
+func (f Filtro) Aceita(consulta, musica sets.Set) bool {
+	for _, a := range f.Obrigatorios {
+		if !musica.Contains(a) {
+			return false
+		}
+	}
+	for _, a := range f.Proibidos {
+		if musica.Contains(a) {
+			return false
+		}
+	}
+	return f.MaxNovos == nil || musica.Difference(consulta).Cardinality() <= *f.MaxNovos
+}
+
+// aceita é Aceita para a música de id passado, consultando as listas de postagens em vez de materializar os
+// conjuntos de acordes.
+func (idx *Indice) aceita(f Filtro, id int, consulta map[string]bool) bool {
+	for _, a := range f.Obrigatorios {
+		if !idx.acordes[a].Contem(id) {
+			return false
+		}
+	}
+	for _, a := range f.Proibidos {
+		if idx.acordes[a].Contem(id) {
+			return false
+		}
+	}
+	if f.MaxNovos == nil {
+		return true
+	}
+	novos := make(map[string]bool)
+	for _, a := range idx.musicas[id].Acordes {
+		if !consulta[a] {
+			novos[a] = true
+		}
+	}
+	return len(novos) <= *f.MaxNovos
+}
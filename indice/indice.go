@@ -0,0 +1,241 @@
+// Package indice mantém em memória um índice invertido dos acordes do catálogo (acorde -> músicas que o contém),
+// permitindo calcular a similaridade de uma consulta com todas as músicas sem consultar o banco de dados e sem
+// materializar cada candidata.
+package indice
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/danielfireman/deciframe-api/db"
+	"github.com/danielfireman/deciframe-api/model"
+)
+
+type Indice struct {
+	musicas []*model.Musica
+	pesos   []float64 // Soma dos pesos IDF dos acordes de cada música.
+	acordes map[string]Bitset
+	generos map[string]Bitset
+	idf     *PesosIDF
+}
+
+// Novo constrói o índice. O id de cada música no índice é sua posição em musicas.
+func Novo(musicas []*model.Musica) *Indice {
+	idx := &Indice{
+		musicas: musicas,
+		pesos:   make([]float64, len(musicas)),
+		acordes: make(map[string]Bitset),
+		generos: make(map[string]Bitset),
+	}
+	freq := make(map[string]int)
+	for id, m := range musicas {
+		for _, a := range m.Acordes {
+			if _, ok := idx.acordes[a]; !ok {
+				idx.acordes[a] = NovoBitset(len(musicas))
+			}
+			if !idx.acordes[a].Contem(id) {
+				idx.acordes[a].Adiciona(id)
+				freq[a]++
+			}
+		}
+		if _, ok := idx.generos[m.Genero]; !ok {
+			idx.generos[m.Genero] = NovoBitset(len(musicas))
+		}
+		idx.generos[m.Genero].Adiciona(id)
+	}
+	idx.idf = NovosPesosIDF(freq, len(musicas))
+	for id, m := range musicas {
+		for _, a := range m.Acordes {
+			idx.pesos[id] += idx.idf.Peso(a)
+		}
+	}
+	return idx
+}
+
+// PesosIDF retorna os pesos IDF calculados a partir do catálogo indexado.
+func (idx *Indice) PesosIDF() *PesosIDF {
+	return idx.idf
+}
+
+type Resultado struct {
+	Musica     *model.Musica
+	Comparacao Comparacao
+	Pontuacao  float64
+}
+
+// Consulta descreve uma busca no índice.
+type Consulta struct {
+	Acordes []string
+	Generos []string           // Se algum for passado, apenas músicas desses gêneros são consideradas.
+	Excluir map[string]bool    // id_unico_musica das músicas ignoradas.
+	Fatores map[string]float64 // Multiplicam o peso IDF dos acordes da consulta. O fator padrão é 1.
+	Filtro
+}
+
+// Busca pontua todas as músicas que têm ao menos um acorde em comum com a consulta e que pertencem a um dos gêneros
+// (se algum for passado), retornando as k de maior pontuação, da melhor para a pior, e o número total de músicas
+// pontuadas. Músicas com menos de dois acordes distintos, as músicas em c.Excluir e as que não satisfazem c.Filtro
+// são ignoradas.
+func (idx *Indice) Busca(c Consulta, k int, pontua func(Comparacao) float64) ([]*Resultado, int) {
+	var filtroGeneros Bitset
+	if len(c.Generos) > 0 {
+		filtroGeneros = NovoBitset(len(idx.musicas))
+		for _, g := range c.Generos {
+			if b, ok := idx.generos[g]; ok {
+				filtroGeneros.Uniao(b)
+			}
+		}
+	}
+
+	// Acumuladores indexados pelo id da música: tamanho e peso da interseção com a consulta e, se algum acorde tem
+	// fator, o ajuste do peso da música. candidatas guarda os ids com interseção, na ordem em que foram encontrados.
+	intersecao := make([]int, len(idx.musicas))
+	pesoIntersecao := make([]float64, len(idx.musicas))
+	var ajustePesoMusica []float64
+	if len(c.Fatores) > 0 {
+		ajustePesoMusica = make([]float64, len(idx.musicas))
+	}
+	var candidatas []int
+	distintos := make(map[string]bool)
+	pesoConsulta := 0.0
+	for _, a := range c.Acordes {
+		if distintos[a] {
+			continue
+		}
+		distintos[a] = true
+		idf := idx.idf.Peso(a)
+		peso := idf
+		if f, ok := c.Fatores[a]; ok {
+			peso *= f
+		}
+		pesoConsulta += peso
+		postagens, ok := idx.acordes[a]
+		if !ok {
+			continue
+		}
+		postagens.ParaCada(func(id int) {
+			if filtroGeneros == nil || filtroGeneros.Contem(id) {
+				if intersecao[id] == 0 {
+					candidatas = append(candidatas, id)
+				}
+				intersecao[id]++
+				pesoIntersecao[id] += peso
+				if peso != idf {
+					ajustePesoMusica[id] += peso - idf
+				}
+			}
+		})
+	}
+
+	melhores := NovaSelecao(k)
+	for _, id := range candidatas {
+		m := idx.musicas[id]
+		if len(m.Acordes) < 2 || c.Excluir[m.UniqueID] || !idx.aceita(c.Filtro, id, distintos) {
+			continue
+		}
+		comp := Comparacao{
+			Intersecao:     intersecao[id],
+			Consulta:       len(distintos),
+			Musica:         len(m.Acordes),
+			PesoIntersecao: pesoIntersecao[id],
+			PesoConsulta:   pesoConsulta,
+			PesoMusica:     idx.pesos[id],
+		}
+		if ajustePesoMusica != nil {
+			comp.PesoMusica += ajustePesoMusica[id]
+		}
+		melhores.Adiciona(&Resultado{Musica: m, Comparacao: comp, Pontuacao: pontua(comp)})
+	}
+	return melhores.Ordenados(), melhores.Total()
+}
+
+// Atualizado mantém um índice reconstruído periodicamente a partir do repositório.
+type Atualizado struct {
+	mu        sync.RWMutex
+	atual     *Indice
+	repo      db.Repositorio
+	encerrado chan struct{}
+}
+
+// Intervalo inicial entre as tentativas de construir o índice enquanto nenhuma teve sucesso. Ele dobra a cada
+// falha, até o intervalo entre reconstruções.
+const RETENTATIVA = time.Second
+
+// Mantem constrói o índice a partir de todas as músicas do repositório e o reconstrói a cada intervalo, até que o
+// contexto termine. Se a primeira construção falhar, o erro é retornado junto com o *Atualizado, que continua
+// tentando com intervalos crescentes; até lá, Indice retorna nil. Falhas nas reconstruções seguintes são registradas
+// no log e o índice anterior continua em uso.
+func Mantem(ctx context.Context, repo db.Repositorio, intervalo time.Duration) (*Atualizado, error) {
+	a := &Atualizado{repo: repo, encerrado: make(chan struct{})}
+	err := a.atualiza(ctx)
+	espera := intervalo
+	if err != nil {
+		espera = retentativa(0, intervalo)
+	}
+	go func() {
+		defer close(a.encerrado)
+		timer := time.NewTimer(espera)
+		defer timer.Stop()
+		for {
+			select {
+			case <-timer.C:
+				construido := a.Indice() != nil
+				switch err := a.atualiza(ctx); {
+				case err == nil:
+					if !construido {
+						log.Println("Índice de acordes construído.")
+					}
+					espera = intervalo
+				case ctx.Err() == nil:
+					if !construido {
+						espera = retentativa(espera, intervalo)
+					}
+					log.Printf("Erro atualizando índice de acordes, nova tentativa em %s: %q", espera, err)
+				}
+				timer.Reset(espera)
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return a, err
+}
+
+// retentativa retorna o intervalo até a próxima tentativa de construir o índice, dado o anterior (zero na primeira).
+func retentativa(anterior, max time.Duration) time.Duration {
+	proxima := 2 * anterior
+	if proxima < RETENTATIVA {
+		proxima = RETENTATIVA
+	}
+	if proxima > max {
+		proxima = max
+	}
+	return proxima
+}
+
+// Encerrado retorna um canal fechado quando as reconstruções param, depois que o contexto passado a Mantem termina.
+// Depois disso o repositório não é mais usado.
+func (a *Atualizado) Encerrado() <-chan struct{} {
+	return a.encerrado
+}
+
+func (a *Atualizado) atualiza(ctx context.Context) error {
+	musicas, err := a.repo.TodasMusicas(ctx)
+	if err != nil {
+		return err
+	}
+	idx := Novo(musicas)
+	a.mu.Lock()
+	a.atual = idx
+	a.mu.Unlock()
+	return nil
+}
+
+// Indice retorna o índice atual, ou nil se ele ainda não foi construído.
+func (a *Atualizado) Indice() *Indice {
+	a.mu.RLock()
+	defer a.mu.RUnlock()
+	return a.atual
+}
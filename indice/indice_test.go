@@ -0,0 +1,187 @@
+package indice
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/danielfireman/deciframe-api/db"
+	"github.com/danielfireman/deciframe-api/model"
+)
+
+func musicaTeste(id, genero string, popularidade int, acordes ...string) *model.Musica {
+	return &model.Musica{UniqueID: id, Genero: genero, Popularidade: popularidade, Acordes: acordes}
+}
+
+var catalogoTeste = []*model.Musica{
+	musicaTeste("a", "Rock", 10, "C", "G", "Am", "F"),
+	musicaTeste("b", "Rock", 20, "C", "G", "D"),
+	musicaTeste("c", "MPB", 30, "Am", "Dm", "E7"),
+	musicaTeste("d", "MPB", 40, "C", "G", "Am", "F", "E7"),
+	musicaTeste("e", "Rock", 50, "C"), // Menos de dois acordes distintos: nunca é resultado.
+	musicaTeste("f", "Samba", 60, "Bb", "Eb"),
+}
+
+func porIntersecao(c Comparacao) float64 {
+	return float64(c.Intersecao) - float64(c.Diferenca())/10
+}
+
+func TestBusca(t *testing.T) {
+	um := 1
+	data := []struct {
+		desc      string
+		consulta  Consulta
+		k         int
+		want      []string
+		wantTotal int
+	}{
+		{"acordes", Consulta{Acordes: []string{"C", "G", "Am", "F"}}, 10, []string{"a", "d", "b", "c"}, 4},
+		{"k menor que o total", Consulta{Acordes: []string{"C", "G", "Am", "F"}}, 2, []string{"a", "d"}, 4},
+		{"acordes repetidos", Consulta{Acordes: []string{"C", "C", "G", "G"}}, 10, []string{"b", "a", "d"}, 3},
+		{"gêneros", Consulta{Acordes: []string{"C", "G", "Am", "F"}, Generos: []string{"MPB"}}, 10, []string{"d", "c"}, 2},
+		{"gênero inexistente", Consulta{Acordes: []string{"C"}, Generos: []string{"Jazz"}}, 10, []string{}, 0},
+		{"excluir", Consulta{Acordes: []string{"C", "G", "Am", "F"}, Excluir: map[string]bool{"a": true}}, 10, []string{"d", "b", "c"}, 3},
+		{"obrigatórios", Consulta{Acordes: []string{"C", "G"}, Filtro: Filtro{Obrigatorios: []string{"F"}}}, 10, []string{"a", "d"}, 2},
+		{"proibidos", Consulta{Acordes: []string{"C", "G"}, Filtro: Filtro{Proibidos: []string{"E7"}}}, 10, []string{"b", "a"}, 2},
+		{"máximo de acordes novos", Consulta{Acordes: []string{"C", "G", "Am"}, Filtro: Filtro{MaxNovos: &um}}, 10, []string{"a", "b"}, 2},
+		{"acorde fora do catálogo", Consulta{Acordes: []string{"C#m7(b5)"}}, 10, []string{}, 0},
+	}
+	idx := Novo(catalogoTeste)
+	for _, d := range data {
+		res, total := idx.Busca(d.consulta, d.k, porIntersecao)
+		if got := uniqueIDs(res); !reflect.DeepEqual(got, d.want) || total != d.wantTotal {
+			t.Errorf("%s: Busca(%+v) = %v, %d, want %v, %d", d.desc, d.consulta, got, total, d.want, d.wantTotal)
+		}
+	}
+}
+
+func TestBusca_Comparacao(t *testing.T) {
+	idx := Novo(catalogoTeste)
+	res, _ := idx.Busca(Consulta{Acordes: []string{"C", "G", "X"}, Fatores: map[string]float64{"G": 2}}, 10, porIntersecao)
+	var b *Resultado
+	for _, r := range res {
+		if r.Musica.UniqueID == "b" {
+			b = r
+		}
+	}
+	if b == nil {
+		t.Fatalf("Busca não retornou a música b: %v", uniqueIDs(res))
+	}
+	idf := idx.PesosIDF()
+	want := Comparacao{
+		Intersecao:     2,
+		Consulta:       3,
+		Musica:         3,
+		PesoIntersecao: idf.Peso("C") + 2*idf.Peso("G"),
+		PesoConsulta:   idf.Peso("C") + 2*idf.Peso("G") + idf.Peso("X"),
+		PesoMusica:     idf.Peso("C") + 2*idf.Peso("G") + idf.Peso("D"),
+	}
+	if b.Comparacao != want {
+		t.Errorf("Comparacao = %+v, want %+v", b.Comparacao, want)
+	}
+	// A busca no índice compara como Compara faria com os mesmos pesos.
+	escalados := idf.Escala(map[string]float64{"G": 2})
+	if got := Compara(conjunto([]string{"C", "G", "X"}), conjunto([]string{"C", "G", "D"}), escalados); got != want {
+		t.Errorf("Compara = %+v, want %+v", got, want)
+	}
+}
+
+// repoTeste é um db.Repositorio que implementa apenas TodasMusicas, cujo resultado pode ser trocado durante o teste.
+type repoTeste struct {
+	db.Repositorio
+
+	mu      sync.Mutex
+	musicas []*model.Musica
+	err     error
+}
+
+func (r *repoTeste) TodasMusicas(ctx context.Context) ([]*model.Musica, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.musicas, r.err
+}
+
+func (r *repoTeste) troca(musicas []*model.Musica, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.musicas, r.err = musicas, err
+}
+
+// aguarda espera até que cond seja verdadeira, falhando o teste se isso não acontecer em alguns segundos.
+func aguarda(t *testing.T, desc string, cond func() bool) {
+	t.Helper()
+	for limite := time.Now().Add(5 * time.Second); !cond(); time.Sleep(time.Millisecond) {
+		if time.Now().After(limite) {
+			t.Fatalf("%s: tempo esgotado", desc)
+		}
+	}
+}
+
+func TestMantem_Reconstroi(t *testing.T) {
+	repo := &repoTeste{musicas: catalogoTeste[:2]}
+	ctx, cancela := context.WithCancel(context.Background())
+	a, err := Mantem(ctx, repo, 5*time.Millisecond)
+	if err != nil {
+		t.Fatalf("Mantem: %q", err)
+	}
+	primeiro := a.Indice()
+	if primeiro == nil || len(primeiro.musicas) != 2 {
+		t.Fatalf("Indice() = %+v, want índice com 2 músicas", primeiro)
+	}
+
+	// Uma reconstrução que falha mantém o índice anterior.
+	repo.troca(nil, errors.New("repositório indisponível"))
+	time.Sleep(20 * time.Millisecond)
+	if a.Indice() != primeiro {
+		t.Errorf("Indice() mudou depois de reconstruções que falharam")
+	}
+
+	// A próxima reconstrução bem-sucedida substitui o índice.
+	repo.troca(catalogoTeste, nil)
+	aguarda(t, "troca do índice", func() bool { return len(a.Indice().musicas) == len(catalogoTeste) })
+
+	cancela()
+	aguarda(t, "encerramento", func() bool {
+		select {
+		case <-a.Encerrado():
+			return true
+		default:
+			return false
+		}
+	})
+}
+
+func TestMantem_PrimeiraConstrucaoFalha(t *testing.T) {
+	errRepo := errors.New("repositório indisponível")
+	repo := &repoTeste{err: errRepo}
+	ctx, cancela := context.WithCancel(context.Background())
+	defer cancela()
+	a, err := Mantem(ctx, repo, 5*time.Millisecond)
+	if err != errRepo || a == nil {
+		t.Fatalf("Mantem = %v, %q, want *Atualizado, %q", a, err, errRepo)
+	}
+	if a.Indice() != nil {
+		t.Errorf("Indice() = %+v antes de alguma construção, want nil", a.Indice())
+	}
+	repo.troca(catalogoTeste, nil)
+	aguarda(t, "nova tentativa", func() bool { return a.Indice() != nil })
+}
+
+func TestRetentativa(t *testing.T) {
+	data := []struct {
+		anterior, max, want time.Duration
+	}{
+		{0, time.Hour, RETENTATIVA},
+		{RETENTATIVA, time.Hour, 2 * RETENTATIVA},
+		{40 * time.Minute, time.Hour, time.Hour},
+		{0, time.Millisecond, time.Millisecond},
+	}
+	for _, d := range data {
+		if got := retentativa(d.anterior, d.max); got != d.want {
+			t.Errorf("retentativa(%s, %s) = %s, want %s", d.anterior, d.max, got, d.want)
+		}
+	}
+}
@@ -0,0 +1,64 @@
+package indice
+
+import "container/heap"
+
+// melhor define a ordem dos resultados: maior pontuação primeiro, empates resolvidos pela maior popularidade e,
+// por fim, pelo id_unico_musica, de forma que a ordem (e portanto a paginação) não dependa da ordem de inserção.
+func melhor(a, b *Resultado) bool {
+	if a.Pontuacao != b.Pontuacao {
+		return a.Pontuacao > b.Pontuacao
+	}
+	if a.Musica.Popularidade != b.Musica.Popularidade {
+		return a.Musica.Popularidade > b.Musica.Popularidade
+	}
+	return a.Musica.UniqueID < b.Musica.UniqueID
+}
+
+// Selecao mantém os k melhores resultados vistos até o momento em um heap cuja raiz é o pior deles. Cada inserção
+// custa O(log k) e a memória usada não depende do número de candidatas.
+type Selecao struct {
+	k          int
+	resultados []*Resultado
+	total      int
+}
+
+func NovaSelecao(k int) *Selecao {
+	return &Selecao{k: k}
+}
+
+func (s *Selecao) Len() int           { return len(s.resultados) }
+func (s *Selecao) Less(i, j int) bool { return melhor(s.resultados[j], s.resultados[i]) }
+func (s *Selecao) Swap(i, j int)      { s.resultados[i], s.resultados[j] = s.resultados[j], s.resultados[i] }
+func (s *Selecao) Push(x interface{}) { s.resultados = append(s.resultados, x.(*Resultado)) }
+func (s *Selecao) Pop() interface{} {
+	ultimo := s.resultados[len(s.resultados)-1]
+	s.resultados = s.resultados[:len(s.resultados)-1]
+	return ultimo
+}
+
+// Adiciona insere o resultado se ele estiver entre os k melhores, descartando o pior quando necessário.
+func (s *Selecao) Adiciona(r *Resultado) {
+	s.total++
+	switch {
+	case s.k <= 0:
+	case len(s.resultados) < s.k:
+		heap.Push(s, r)
+	case melhor(r, s.resultados[0]):
+		s.resultados[0] = r
+		heap.Fix(s, 0)
+	}
+}
+
+// Total retorna o número de resultados adicionados, incluindo os descartados.
+func (s *Selecao) Total() int {
+	return s.total
+}
+
+// Ordenados esvazia a seleção, retornando os resultados do melhor para o pior.
+func (s *Selecao) Ordenados() []*Resultado {
+	res := make([]*Resultado, len(s.resultados))
+	for i := len(res) - 1; i >= 0; i-- {
+		res[i] = heap.Pop(s).(*Resultado)
+	}
+	return res
+}
@@ -0,0 +1,59 @@
+package indice
+
+import (
+	"math/rand"
+	"reflect"
+	"testing"
+
+	"github.com/danielfireman/deciframe-api/model"
+)
+
+func resultado(id string, popularidade int, pontuacao float64) *Resultado {
+	return &Resultado{Musica: &model.Musica{UniqueID: id, Popularidade: popularidade}, Pontuacao: pontuacao}
+}
+
+func uniqueIDs(res []*Resultado) []string {
+	ids := []string{}
+	for _, r := range res {
+		ids = append(ids, r.Musica.UniqueID)
+	}
+	return ids
+}
+
+func TestSelecao(t *testing.T) {
+	todos := []*Resultado{
+		resultado("a", 10, 0.5),
+		resultado("b", 30, 0.9),
+		resultado("c", 20, 0.5),
+		resultado("d", 20, 0.5),
+		resultado("e", 99, 0.1),
+		resultado("f", 5, 1),
+	}
+	data := []struct {
+		desc string
+		k    int
+		want []string
+	}{
+		{"todos", 10, []string{"f", "b", "c", "d", "a", "e"}},
+		{"empates por popularidade e id", 4, []string{"f", "b", "c", "d"}},
+		{"apenas o melhor", 1, []string{"f"}},
+		{"nenhum", 0, []string{}},
+	}
+	r := rand.New(rand.NewSource(1))
+	for _, d := range data {
+		// A seleção não depende da ordem em que os resultados são adicionados.
+		for i := 0; i < 10; i++ {
+			s := NovaSelecao(d.k)
+			for _, j := range r.Perm(len(todos)) {
+				s.Adiciona(todos[j])
+			}
+			if s.Total() != len(todos) {
+				t.Errorf("%s: Total() = %d, want %d", d.desc, s.Total(), len(todos))
+			}
+			if got := uniqueIDs(s.Ordenados()); !reflect.DeepEqual(got, d.want) {
+				t.Errorf("%s: Ordenados() = %v, want %v", d.desc, got, d.want)
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,194 @@
+// Package limite protege os tratadores mais caros do serviço: limita o número de requisições de cada cliente
+// (token bucket por IP) e o número de requisições processadas concorrentemente, recusando com 429 ou 503 as que
+// não puderem ser atendidas em vez de enfileirá-las indefinidamente.
+package limite
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danielfireman/deciframe-api/erro"
+	"gopkg.in/bsm/ratelimit.v1"
+)
+
+// Valores padrão, usados quando o campo correspondente de Config não é positivo.
+const (
+	CONCORRENCIA = 5
+	ESPERA       = 2 * time.Second
+	PERIODO      = time.Minute
+
+	// Clientes sem requisições por mais que EXPIRACAO_CLIENTE têm seu limitador descartado.
+	EXPIRACAO_CLIENTE = 10 * time.Minute
+
+	// Número máximo de clientes com limitador próprio. Enquanto houver MAX_CLIENTES clientes ativos, os novos
+	// dividem um mesmo limitador, de forma que a memória usada não cresce com o número de IPs.
+	MAX_CLIENTES = 100000
+)
+
+type Config struct {
+	Concorrencia          int           // Número máximo de requisições processadas ao mesmo tempo.
+	Espera                time.Duration // Tempo máximo que uma requisição aguarda por uma vaga.
+	RequisicoesPorCliente int           // Requisições permitidas a cada IP por Periodo. Zero desativa o limite.
+	Periodo               time.Duration
+
+	// ConfiaNoProxy identifica o cliente pelo último endereço do cabeçalho X-Forwarded-For, o que só é seguro
+	// quando o serviço roda atrás de um proxy que o preenche (como o roteador do Heroku). Sem proxy, qualquer
+	// cliente poderia escolher o próprio IP e escapar do limite.
+	ConfiaNoProxy bool
+}
+
+// Recusa é o erro retornado quando uma requisição não pode ser atendida agora.
+type Recusa struct {
+	Status  int           // http.StatusTooManyRequests ou http.StatusServiceUnavailable.
+	TenteEm time.Duration // Valor do cabeçalho Retry-After.
+}
+
+func (r *Recusa) Error() string {
+	return http.StatusText(r.Status)
+}
+
+// Escreve responde a requisição recusada, informando ao cliente quando tentar novamente.
+func (r *Recusa) Escreve(w http.ResponseWriter, req *http.Request) {
+	segundos := int((r.TenteEm + time.Second - 1) / time.Second)
+	if segundos < 1 {
+		segundos = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(segundos))
+	if r.Status == http.StatusTooManyRequests {
+		erro.Escreve(w, req, erro.Novo(r.Status, erro.MUITAS_REQUISICOES,
+			fmt.Sprintf("Limite de requisições excedido, tente novamente em %d segundos.", segundos),
+			fmt.Sprintf("Rate limit exceeded, try again in %d seconds.", segundos)))
+		return
+	}
+	erro.Escreve(w, req, erro.Novo(r.Status, erro.SOBRECARREGADO,
+		fmt.Sprintf("Serviço sobrecarregado, tente novamente em %d segundos.", segundos),
+		fmt.Sprintf("Service overloaded, try again in %d seconds.", segundos)))
+}
+
+type Limitador struct {
+	cfg   Config
+	vagas chan struct{}
+
+	mu         sync.Mutex
+	clientes   map[string]*cliente
+	excedentes *ratelimit.RateLimiter // Compartilhado pelos clientes além de MAX_CLIENTES.
+}
+
+type cliente struct {
+	limitador *ratelimit.RateLimiter
+	visto     time.Time
+}
+
+// Novo cria o limitador. Os limitadores de clientes inativos são descartados periodicamente até ctx ser cancelado.
+func Novo(ctx context.Context, cfg Config) *Limitador {
+	if cfg.Concorrencia <= 0 {
+		cfg.Concorrencia = CONCORRENCIA
+	}
+	if cfg.Espera <= 0 {
+		cfg.Espera = ESPERA
+	}
+	if cfg.Periodo <= 0 {
+		cfg.Periodo = PERIODO
+	}
+	l := &Limitador{
+		cfg:      cfg,
+		vagas:    make(chan struct{}, cfg.Concorrencia),
+		clientes: make(map[string]*cliente),
+	}
+	if cfg.RequisicoesPorCliente > 0 {
+		l.excedentes = ratelimit.New(cfg.RequisicoesPorCliente, cfg.Periodo)
+		go func() {
+			ticker := time.NewTicker(EXPIRACAO_CLIENTE)
+			defer ticker.Stop()
+			for {
+				select {
+				case <-ticker.C:
+					l.descartaInativos()
+				case <-ctx.Done():
+					return
+				}
+			}
+		}()
+	}
+	return l
+}
+
+// Entra admite a requisição, aguardando no máximo Config.Espera por uma vaga. Se admitida, a função retornada
+// deve ser chamada ao final do processamento para liberar a vaga; caso contrário o erro é uma *Recusa ou, se a
+// requisição foi cancelada durante a espera, o erro do seu contexto.
+func (l *Limitador) Entra(r *http.Request) (func(), error) {
+	rl := l.limitador(IP(r, l.cfg.ConfiaNoProxy))
+	if rl != nil && rl.Limit() {
+		return nil, &Recusa{Status: http.StatusTooManyRequests, TenteEm: l.cfg.Periodo / time.Duration(l.cfg.RequisicoesPorCliente)}
+	}
+	espera := time.NewTimer(l.cfg.Espera)
+	defer espera.Stop()
+	select {
+	case l.vagas <- struct{}{}:
+		return func() { <-l.vagas }, nil
+	case <-espera.C:
+		// A requisição não foi atendida, então não deve contar no limite do cliente.
+		if rl != nil {
+			rl.Undo()
+		}
+		return nil, &Recusa{Status: http.StatusServiceUnavailable, TenteEm: l.cfg.Espera}
+	case <-r.Context().Done():
+		if rl != nil {
+			rl.Undo()
+		}
+		return nil, r.Context().Err()
+	}
+}
+
+// limitador retorna o token bucket do cliente, ou nil se não há limite por cliente.
+func (l *Limitador) limitador(ip string) *ratelimit.RateLimiter {
+	if l.cfg.RequisicoesPorCliente <= 0 {
+		return nil
+	}
+	l.mu.Lock()
+	c, ok := l.clientes[ip]
+	if !ok {
+		if len(l.clientes) >= MAX_CLIENTES {
+			l.mu.Unlock()
+			return l.excedentes
+		}
+		c = &cliente{limitador: ratelimit.New(l.cfg.RequisicoesPorCliente, l.cfg.Periodo)}
+		l.clientes[ip] = c
+	}
+	c.visto = time.Now()
+	l.mu.Unlock()
+	return c.limitador
+}
+
+func (l *Limitador) descartaInativos() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	for ip, c := range l.clientes {
+		if time.Since(c.visto) > EXPIRACAO_CLIENTE {
+			delete(l.clientes, ip)
+		}
+	}
+}
+
+// IP retorna o endereço do cliente. Se confiaNoProxy, é o último do cabeçalho X-Forwarded-For, adicionado pelo
+// proxy com o endereço de quem se conectou a ele; os anteriores são enviados pelo próprio cliente e não são
+// confiáveis. Caso contrário, o cabeçalho é ignorado e o endereço é o da conexão.
+func IP(r *http.Request, confiaNoProxy bool) string {
+	if xff := r.Header.Get("X-Forwarded-For"); confiaNoProxy && xff != "" {
+		ips := strings.Split(xff, ",")
+		if ip := strings.TrimSpace(ips[len(ips)-1]); ip != "" {
+			return ip
+		}
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
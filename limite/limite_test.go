@@ -0,0 +1,50 @@
+package limite
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"testing"
+)
+
+func TestIP(t *testing.T) {
+	data := []struct {
+		desc          string
+		xff           string
+		confiaNoProxy bool
+		want          string
+	}{
+		{"sem proxy, sem cabeçalho", "", false, "10.0.0.1"},
+		{"sem proxy, cabeçalho ignorado", "1.2.3.4", false, "10.0.0.1"},
+		{"com proxy, sem cabeçalho", "", true, "10.0.0.1"},
+		{"com proxy", "1.2.3.4", true, "1.2.3.4"},
+		{"com proxy, endereços enviados pelo cliente", "6.6.6.6, 1.2.3.4", true, "1.2.3.4"},
+		{"com proxy, último endereço vazio", "1.2.3.4, ", true, "10.0.0.1"},
+	}
+	for _, d := range data {
+		r := &http.Request{RemoteAddr: "10.0.0.1:5000", Header: http.Header{}}
+		if d.xff != "" {
+			r.Header.Set("X-Forwarded-For", d.xff)
+		}
+		if got := IP(r, d.confiaNoProxy); got != d.want {
+			t.Errorf("%s: IP(%q, %v) = %q, want %q", d.desc, d.xff, d.confiaNoProxy, got, d.want)
+		}
+	}
+}
+
+func TestLimitador_MaxClientes(t *testing.T) {
+	ctx, cancela := context.WithCancel(context.Background())
+	defer cancela()
+	l := Novo(ctx, Config{RequisicoesPorCliente: 1})
+	for i := 0; i < MAX_CLIENTES; i++ {
+		if l.limitador(strconv.Itoa(i)) == l.excedentes {
+			t.Fatalf("cliente %d usou o limitador compartilhado antes de atingir MAX_CLIENTES", i)
+		}
+	}
+	if got := l.limitador("novo"); got != l.excedentes {
+		t.Errorf("limitador de cliente além de MAX_CLIENTES = %p, want compartilhado %p", got, l.excedentes)
+	}
+	if len(l.clientes) != MAX_CLIENTES {
+		t.Errorf("len(clientes) = %d, want %d", len(l.clientes), MAX_CLIENTES)
+	}
+}
@@ -1,77 +1,198 @@
 package main
 
 import (
-	"encoding/json"
-	"fmt"
+	"context"
+	"flag"
 	"log"
 	"net/http"
-	"net/url"
 	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
-	"gopkg.in/go-redis/cache.v4"
-	"gopkg.in/redis.v4"
-
+	"github.com/danielfireman/deciframe-api/artistas"
+	"github.com/danielfireman/deciframe-api/busca"
+	"github.com/danielfireman/deciframe-api/cache"
+	"github.com/danielfireman/deciframe-api/config"
 	"github.com/danielfireman/deciframe-api/db"
+	"github.com/danielfireman/deciframe-api/erro"
+	"github.com/danielfireman/deciframe-api/generos"
+	"github.com/danielfireman/deciframe-api/indice"
+	"github.com/danielfireman/deciframe-api/limite"
+	"github.com/danielfireman/deciframe-api/musicas"
+	"github.com/danielfireman/deciframe-api/prazo"
+	"github.com/danielfireman/deciframe-api/saude"
+	"github.com/danielfireman/deciframe-api/sequencias"
 	"github.com/danielfireman/deciframe-api/similares"
+	"github.com/danielfireman/deciframe-api/telemetria"
 	"github.com/julienschmidt/httprouter"
-	"github.com/newrelic/go-agent"
+)
+
+var (
+	arquivoConfig = flag.String("config", os.Getenv("CONFIG"), "Arquivo de configuração (.yaml, .yml ou .json). Padrão: $CONFIG.")
+	imprimeConfig = flag.Bool("print-config", false, "Imprime a configuração carregada, com os segredos ocultos, e termina.")
 )
 
 func main() {
-	port := os.Getenv("PORT")
-	if port == "" {
-		log.Fatal("$PORT must be set")
+	flag.Parse()
+	cfg, err := config.Carrega(*arquivoConfig)
+	if *imprimeConfig {
+		if errImpressao := cfg.Imprime(os.Stdout); errImpressao != nil {
+			log.Fatal(errImpressao)
+		}
+		// Os problemas de validação são listados depois da configuração.
+		if err != nil {
+			log.Println(err)
+			os.Exit(1)
+		}
+		return
 	}
-	log.Println("Porta utilizada", port)
-
-	mgoDB, err := db.Mongo(os.Getenv("MONGODB_URI"))
 	if err != nil {
-		log.Fatalf("Error connecting to DB: %q", err)
+		log.Fatal(err)
 	}
-	log.Println("MongoDB conectado.")
+	log.Println("Porta utilizada", cfg.Porta)
 
-	redisCache, err := Redis(os.Getenv("REDIS_URL"))
-	if err != nil {
-		log.Fatal(err)
+	// Sem MongoDB, as músicas são carregadas em memória a partir do CSV.
+	var repo db.Repositorio
+	dependencias := []saude.Dependencia{{Nome: "repositorio", Essencial: true}}
+	if cfg.MongoDBURI == "" {
+		f, err := os.Open(cfg.MusicasCSV)
+		if err != nil {
+			log.Fatalf("Erro abrindo CSV de músicas: %q", err)
+		}
+		repo, err = db.MemoriaDeCSV(f)
+		f.Close()
+		if err != nil {
+			log.Fatalf("Erro carregando CSV de músicas: %q", err)
+		}
+		log.Println("Músicas carregadas em memória.")
+	} else {
+		mgoDB, err := db.Mongo(cfg.MongoDBURI)
+		if err != nil {
+			log.Fatalf("Error connecting to DB: %q", err)
+		}
+		repo = mgoDB
+		dependencias[0].Nome = "mongodb"
+		log.Println("MongoDB conectado.")
 	}
-	log.Println("Redis cache conectado.")
+	dependencias[0].Ping = repo.Ping
 
-	nrLicence := os.Getenv("NEW_RELIC_LICENSE_KEY")
-	if nrLicence == "" {
-		log.Fatal("$NEW_RELIC_LICENSE_KEY must be set")
+	// Sem Redis, usamos apenas o cache em memória. Com Redis, o cache em memória fica na frente dele.
+	expiracaoLocal := time.Duration(cfg.Cache.ExpiracaoLocal)
+	var c cache.Cache = cache.Memoria(cfg.Cache.TamanhoLocal, expiracaoLocal)
+	if cfg.RedisURL != "" {
+		redisCache, err := cache.Redis(cfg.RedisURL)
+		if err != nil {
+			log.Fatal(err)
+		}
+		c = cache.DuasCamadas(c, redisCache, expiracaoLocal)
+		dependencias = append(dependencias, saude.Dependencia{Nome: "redis", Ping: redisCache.Ping})
+		log.Println("Redis cache conectado.")
+	} else {
+		log.Println("Redis não configurado, usando apenas cache em memória.")
 	}
-	app, err := newrelic.NewApplication(newrelic.NewConfig("deciframe-api", nrLicence))
+
+	// Sem o índice, /similares continua funcionando consultando diretamente o repositório. As reconstruções do
+	// índice (e a limpeza do limitador de /similares) param quando o serviço é encerrado.
+	ctx, cancela := context.WithCancel(context.Background())
+	defer cancela()
+	idx, err := indice.Mantem(ctx, repo, time.Duration(cfg.Similares.AtualizacaoIndice))
 	if err != nil {
-		log.Fatal(err)
+		log.Printf("Erro construindo índice de acordes, usando apenas o repositório até que ele seja construído: %q", err)
+	} else {
+		log.Println("Índice de acordes construído.")
 	}
-	log.Println("Monitoramento NewRelic configurado com sucesso.")
 
-	router := httprouter.New()
-	s := similares.FabricaDeTratadores(mgoDB, redisCache, app)
-	router.GET("/similares", s.GetHandler())
+	// As métricas são sempre expostas em /metrics. O New Relic é usado apenas se a licença estiver configurada.
+	metricas := telemetria.NovoPrometheus()
+	app := telemetria.Combina(metricas)
+	if cfg.NewRelicLicenca != "" {
+		nr, err := telemetria.NewRelic("deciframe-api", cfg.NewRelicLicenca)
+		if err != nil {
+			log.Fatal(err)
+		}
+		app = telemetria.Combina(nr, metricas)
+		log.Println("Monitoramento NewRelic configurado com sucesso.")
+	} else {
+		log.Println("Licença do New Relic não configurada, monitoramento apenas em /metrics.")
+	}
 
-	log.Println("Serviço inicializado na porta ", port)
-	log.Fatal(http.ListenAndServe(":"+port, router))
-}
+	limitador := limite.Novo(ctx, limite.Config{
+		Concorrencia:          cfg.Similares.Concorrencia,
+		Espera:                time.Duration(cfg.Similares.Espera),
+		RequisicoesPorCliente: cfg.Similares.RequisicoesPorMinuto,
+		Periodo:               time.Minute,
+		ConfiaNoProxy:         cfg.ConfiaNoProxy,
+	})
+	simCfg := similares.Config{
+		TamPagina:    cfg.Similares.TamPagina,
+		MaxTamPagina: cfg.Similares.MaxTamPagina,
+		Expiracao:    time.Duration(cfg.Similares.ExpiracaoCache),
+	}
+
+	router := httprouter.New()
+	router.NotFound = erro.RotaInexistente()
+	router.MethodNotAllowed = erro.MetodoNaoPermitido()
+	s := similares.FabricaDeTratadores(repo, c, idx, limitador, simCfg, app)
+	router.GET("/similares", prazo.Limita(s.GetHandler(), cfg.Prazo("similares")))
+	router.POST("/similares", prazo.Limita(s.PostHandler(), cfg.Prazo("similares")))
+	router.OPTIONS("/similares", s.OptionsHandler())
+	seq := sequencias.FabricaDeTratadores(repo, app)
+	router.GET("/sequencias", prazo.Limita(seq.GetHandler(), cfg.Prazo("sequencias")))
+	m := musicas.FabricaDeTratadores(repo, app)
+	router.GET("/musicas/:id_unico_musica", prazo.Limita(m.GetHandler(), cfg.Prazo("musicas")))
+	a := artistas.FabricaDeTratadores(repo, app)
+	router.GET("/artistas", prazo.Limita(a.GetHandler(), cfg.Prazo("artistas")))
+	router.GET("/artistas/:id_artista/musicas", prazo.Limita(a.MusicasHandler(), cfg.Prazo("artistas")))
+	g := generos.FabricaDeTratadores(repo, c, time.Duration(cfg.Generos.ExpiracaoCache), app)
+	router.GET("/generos", prazo.Limita(g.GetHandler(), cfg.Prazo("generos")))
+	b := busca.FabricaDeTratadores(repo, app)
+	router.GET("/busca", prazo.Limita(b.GetHandler(), cfg.Prazo("busca")))
+	router.Handler("GET", "/metrics", metricas.Handler())
+	sd := saude.FabricaDeTratadores(saude.TIMEOUT, dependencias...)
+	router.GET("/healthz", sd.VivoHandler())
+	router.GET("/readyz", sd.ProntoHandler())
 
-func Redis(u string) (*cache.Codec, error) {
-	if u == "" {
-		return nil, fmt.Errorf("$REDIS_URL must be set")
+	srv := &http.Server{Addr: ":" + cfg.Porta, Handler: erro.ComIDRequisicao(router)}
+	encerrado := encerraAoReceberSinal(srv, sd, cfg.Encerramento)
+	log.Println("Serviço inicializado na porta ", cfg.Porta)
+	if err := srv.ListenAndServe(); err != http.ErrServerClosed {
+		log.Fatal(err)
 	}
-	redisURL, err := url.Parse(u)
-	if err != nil || redisURL.User == nil {
-		return nil, fmt.Errorf("Ocorreu um erro no parse da URL REDIS ou o usuário não foi determinado. err:'%q'\n", err)
+	if err := <-encerrado; err != nil {
+		// Ainda há requisições em andamento, que podem usar o repositório e o cache a qualquer momento: fechá-los
+		// agora as faria falhar (a sessão do mgo entra em pânico se copiada depois de fechada). O processo termina
+		// sem fechá-los, o que interrompe essas requisições.
+		log.Printf("Requisições em andamento interrompidas após %s: %q", time.Duration(cfg.Encerramento.Drenagem), err)
+		return
 	}
-	pwd, ok := redisURL.User.Password()
-	if !ok {
-		return nil, fmt.Errorf("Não foi possível extrair a senha de REDIS_URL: %s", redisURL)
+
+	// Nenhuma requisição está mais em andamento e, parado o índice, podemos fechar as conexões.
+	cancela()
+	<-idx.Encerrado()
+	if err := c.Close(); err != nil {
+		log.Printf("Erro fechando o cache: %q", err)
 	}
-	return &cache.Codec{
-		Redis: redis.NewClient(&redis.Options{
-			Addr:     redisURL.Host,
-			Password: pwd,
-		}),
-		Marshal:   json.Marshal,
-		Unmarshal: json.Unmarshal,
-	}, nil
+	repo.Close()
+	log.Println("Serviço encerrado.")
+}
+
+// encerraAoReceberSinal espera por SIGTERM ou SIGINT. Ao receber, /readyz passa a responder 503 e, depois do atraso
+// configurado, o servidor para de aceitar conexões e espera pelas requisições em andamento. Quando a drenagem
+// termina, o canal retornado recebe nil ou, se o prazo de drenagem acabou antes do fim das requisições, o erro de
+// srv.Shutdown.
+func encerraAoReceberSinal(srv *http.Server, sd *saude.HandlerFactory, enc config.Encerramento) <-chan error {
+	encerrado := make(chan error, 1)
+	sinais := make(chan os.Signal, 1)
+	signal.Notify(sinais, syscall.SIGTERM, syscall.SIGINT)
+	go func() {
+		log.Printf("Sinal %s recebido, encerrando o serviço.", <-sinais)
+		sd.Encerra()
+		time.Sleep(time.Duration(enc.Atraso))
+
+		ctx, cancel := context.WithTimeout(context.Background(), time.Duration(enc.Drenagem))
+		defer cancel()
+		encerrado <- srv.Shutdown(ctx)
+	}()
+	return encerrado
 }
@@ -0,0 +1,9 @@
+package model
+
+type Artista struct {
+	ID                string   `json:"id_artista"`
+	Nome              string   `json:"nome_artista"`
+	NumMusicas        int      `json:"num_musicas"`
+	Popularidade      int      `json:"popularidade"` // Soma da popularidade das músicas do artista.
+	AcordesMaisUsados []string `json:"acordes_mais_usados"`
+}
@@ -0,0 +1,8 @@
+package model
+
+type Genero struct {
+	Nome                  string   `json:"genero"`
+	NumMusicas            int      `json:"num_musicas"`
+	PopularidadeMedia     float64  `json:"popularidade_media"`
+	AcordesMaisFrequentes []string `json:"acordes_mais_frequentes"`
+}
@@ -13,4 +13,5 @@ type Musica struct {
 	SeqFamosas   []string `json:"seq_famosas"`
 	Tom          string   `json:"tom"`
 	Acordes      []string `json:"acordes"`
+	Graus        []string `json:"graus"`
 }
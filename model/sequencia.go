@@ -0,0 +1,10 @@
+package model
+
+type Sequencia struct {
+	ID       string   `json:"id_sequencia"`
+	Nome     string   `json:"nome"`
+	Graus    []string `json:"graus"`
+	Acordes  []string `json:"acordes"`
+	Exemplos []string `json:"exemplos"`      // id_unico_musica das músicas mais populares que contém a sequência.
+	Tom      string   `json:"tom,omitempty"` // Tom em que a sequência foi encontrada, quando buscada por acordes.
+}
@@ -0,0 +1,100 @@
+package musicas
+
+import (
+	"crypto/sha1"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/danielfireman/deciframe-api/db"
+	"github.com/danielfireman/deciframe-api/erro"
+	"github.com/danielfireman/deciframe-api/resposta"
+	"github.com/danielfireman/deciframe-api/telemetria"
+	"github.com/julienschmidt/httprouter"
+)
+
+type HandlerFactory struct {
+	mon telemetria.Telemetria
+	db  db.Repositorio
+}
+
+func FabricaDeTratadores(db db.Repositorio, mon telemetria.Telemetria) *HandlerFactory {
+	return &HandlerFactory{
+		mon: mon,
+		db:  db,
+	}
+}
+
+// GetHandler retorna o registro completo de uma música, identificada pelo parâmetro de rota id_unico_musica.
+// Suporta requisições condicionais através do cabeçalho If-None-Match (RFC 7232).
+func (s *HandlerFactory) GetHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		txn := s.mon.IniciaTransacao("musicas", w, r)
+		defer txn.Fim()
+		txn.Header().Add("Access-Control-Allow-Origin", "*")
+		txn.Header().Add("Access-Control-Expose-Headers", "ETag")
+
+		buscaIDUnicoSeg := txn.Segmento("busca_id_unico")
+		m, err := s.db.BuscaMusicaPorIDUnico(r.Context(), p.ByName("id_unico_musica"))
+		buscaIDUnicoSeg.Fim()
+		if err != nil {
+			if db.NaoEncontrado(err) {
+				erro.Escreve(txn, r, erro.NaoEncontrado(
+					"Música não encontrada: "+p.ByName("id_unico_musica"),
+					"Song not found: "+p.ByName("id_unico_musica")))
+				return
+			}
+			log.Printf("Erro processando request [%s]: '%q'\n", r.URL.String(), err)
+			erro.Escreve(txn, r, erro.Interno(err))
+			return
+		}
+
+		b, err := json.Marshal(m)
+		if err != nil {
+			log.Printf("Erro processando request [%s]: '%q'\n", r.URL.String(), err)
+			erro.Escreve(txn, r, erro.Interno(err))
+			return
+		}
+		etag := fmt.Sprintf("\"%x\"", sha1.Sum(b))
+		txn.Header().Set("ETag", etag)
+		if casaAlgumaETag(r.Header["If-None-Match"], etag) {
+			txn.WriteHeader(http.StatusNotModified)
+			return
+		}
+		resposta.Escreve(txn, b)
+	}
+}
+
+// casaAlgumaETag verifica se algum dos valores do cabeçalho If-None-Match casa com a etag, seguindo a RFC 7232:
+// cada valor é "*" ou uma lista de etags separadas por vírgula, e a comparação é fraca, ou seja, W/"x" casa com "x".
+// Valores mal formados são ignorados a partir do ponto em que deixam de ser interpretáveis.
+func casaAlgumaETag(valores []string, etag string) bool {
+	etag = strings.TrimPrefix(etag, "W/")
+	for _, v := range valores {
+		for {
+			v = strings.TrimLeft(v, " \t,")
+			if v == "" {
+				break
+			}
+			if v[0] == '*' {
+				return true
+			}
+			v = strings.TrimPrefix(v, "W/")
+			// As etags são delimitadas por aspas e podem conter vírgulas, mas não aspas.
+			if v == "" || v[0] != '"' {
+				break
+			}
+			fim := strings.IndexByte(v[1:], '"')
+			if fim < 0 {
+				break
+			}
+			if v[:fim+2] == etag {
+				return true
+			}
+			v = v[fim+2:]
+		}
+	}
+	return false
+}
@@ -0,0 +1,84 @@
+package musicas
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/danielfireman/deciframe-api/db"
+	"github.com/danielfireman/deciframe-api/telemetria"
+	"github.com/julienschmidt/httprouter"
+)
+
+func TestCasaAlgumaETag(t *testing.T) {
+	const etag = `"abc"`
+	data := []struct {
+		desc    string
+		valores []string
+		want    bool
+	}{
+		{"sem cabeçalho", nil, false},
+		{"igual", []string{`"abc"`}, true},
+		{"diferente", []string{`"abd"`}, false},
+		{"fraca", []string{`W/"abc"`}, true},
+		{"qualquer", []string{`*`}, true},
+		{"lista", []string{`"x", W/"y", "abc"`}, true},
+		{"lista sem espaços", []string{`"x","abc"`}, true},
+		{"lista sem a etag", []string{`"x", W/"y"`}, false},
+		{"vírgula dentro da etag", []string{`"a,b", "abc"`}, true},
+		{"vários cabeçalhos", []string{`"x"`, `W/"abc"`}, true},
+		{"sem aspas", []string{`abc`}, false},
+		{"aspas não fechadas", []string{`"abc`}, false},
+		{"prefixo fraco sem etag", []string{`W/`}, false},
+		{"vazio", []string{``}, false},
+	}
+	for _, d := range data {
+		if got := casaAlgumaETag(d.valores, etag); got != d.want {
+			t.Errorf("%s: casaAlgumaETag(%q, %q) = %v, want %v", d.desc, d.valores, etag, got, d.want)
+		}
+	}
+}
+
+func TestGetHandler_IfNoneMatch(t *testing.T) {
+	repo, err := db.MemoriaDeCSV(strings.NewReader(`"legiao-urbana","tempo-perdido","Legião Urbana","Tempo Perdido","Rock","1.234","C","NA","C; G; Am; F"`))
+	if err != nil {
+		t.Fatalf("MemoriaDeCSV: %q", err)
+	}
+	h := FabricaDeTratadores(repo, telemetria.NovoPrometheus()).GetHandler()
+	get := func(ifNoneMatch ...string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest("GET", "/musicas/legiao-urbana_tempo-perdido", nil)
+		for _, v := range ifNoneMatch {
+			r.Header.Add("If-None-Match", v)
+		}
+		w := httptest.NewRecorder()
+		h(w, r, httprouter.Params{{Key: "id_unico_musica", Value: "legiao-urbana_tempo-perdido"}})
+		return w
+	}
+
+	w := get()
+	etag := w.Header().Get("ETag")
+	if w.Code != http.StatusOK || etag == "" {
+		t.Fatalf("GET = %d com ETag %q, want %d com ETag", w.Code, etag, http.StatusOK)
+	}
+	data := []struct {
+		ifNoneMatch []string
+		want        int
+	}{
+		{[]string{etag}, http.StatusNotModified},
+		{[]string{"W/" + etag}, http.StatusNotModified},
+		{[]string{`"outra", ` + etag}, http.StatusNotModified},
+		{[]string{`"outra"`, etag}, http.StatusNotModified},
+		{[]string{"*"}, http.StatusNotModified},
+		{[]string{`"outra"`}, http.StatusOK},
+	}
+	for _, d := range data {
+		w := get(d.ifNoneMatch...)
+		if w.Code != d.want {
+			t.Errorf("GET com If-None-Match %q = %d, want %d", d.ifNoneMatch, w.Code, d.want)
+		}
+		if w.Code == http.StatusNotModified && w.Body.Len() > 0 {
+			t.Errorf("GET com If-None-Match %q: 304 com corpo %q", d.ifNoneMatch, w.Body.String())
+		}
+	}
+}
@@ -0,0 +1,21 @@
+// Package prazo limita o tempo que cada endpoint tem para responder. O prazo é aplicado ao contexto da requisição,
+// que os tratadores repassam ao repositório e ao cache; quando ele expira, a resposta é 504 (Gateway Timeout).
+package prazo
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+// Limita retorna um tratador que executa h com o contexto da requisição limitado a d. O contexto também é
+// cancelado se o cliente desconectar.
+func Limita(h httprouter.Handle, d time.Duration) httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		ctx, cancel := context.WithTimeout(r.Context(), d)
+		defer cancel()
+		h(w, r.WithContext(ctx), p)
+	}
+}
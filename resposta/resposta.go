@@ -0,0 +1,32 @@
+// Package resposta escreve as respostas de sucesso dos tratadores em JSON, com os mesmos cabeçalhos usados pelo
+// pacote erro nas respostas de erro.
+package resposta
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"github.com/danielfireman/deciframe-api/erro"
+)
+
+const TIPO_JSON = "application/json; charset=utf-8"
+
+// JSON serializa v e o envia como resposta. Se a serialização falhar, responde com um erro interno.
+func JSON(w http.ResponseWriter, r *http.Request, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Erro processando request [%s]: '%q'\n", r.URL.String(), err)
+		erro.Escreve(w, r, erro.Interno(err))
+		return
+	}
+	Escreve(w, b)
+}
+
+// Escreve envia o JSON já serializado.
+func Escreve(w http.ResponseWriter, b []byte) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	w.Header().Set("Content-Type", TIPO_JSON)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.Write(b)
+}
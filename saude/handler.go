@@ -0,0 +1,148 @@
+// Package saude implementa as verificações usadas pelo balanceador de carga e pelo orquestrador: /healthz indica
+// que o processo está no ar e /readyz que as dependências (MongoDB, Redis) respondem.
+package saude
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+)
+
+const (
+	TIMEOUT = 2 * time.Second
+
+	OK           = "ok"
+	DEGRADADO    = "degradado"    // Alguma dependência não essencial falhou; o serviço continua pronto.
+	INDISPONIVEL = "indisponivel" // Alguma dependência essencial falhou.
+	ENCERRANDO   = "encerrando"   // O serviço está sendo encerrado e não deve receber novas requisições.
+	ERRO         = "erro"
+)
+
+// Dependencia é um serviço externo verificado por /readyz. Se uma dependência não essencial falhar (ex: o Redis, sem
+// o qual as respostas apenas deixam de vir do cache compartilhado), o serviço é reportado como degradado mas continua
+// pronto para receber requisições.
+type Dependencia struct {
+	Nome      string
+	Essencial bool
+	Ping      func(ctx context.Context) error
+}
+
+type DependenciaResposta struct {
+	Status     string `json:"status"`
+	Essencial  bool   `json:"essencial"`
+	LatenciaMS int64  `json:"latencia_ms"`
+	Erro       string `json:"erro,omitempty"`
+}
+
+type ProntidaoResposta struct {
+	Status       string                          `json:"status"`
+	Dependencias map[string]*DependenciaResposta `json:"dependencias,omitempty"`
+}
+
+type HandlerFactory struct {
+	dependencias []Dependencia
+	timeout      time.Duration
+	encerrando   int32 // Acessado atomicamente.
+}
+
+// FabricaDeTratadores cria os tratadores de /healthz e /readyz. Cada dependência tem no máximo timeout (TIMEOUT se
+// não for positivo) para responder.
+func FabricaDeTratadores(timeout time.Duration, dependencias ...Dependencia) *HandlerFactory {
+	if timeout <= 0 {
+		timeout = TIMEOUT
+	}
+	return &HandlerFactory{
+		dependencias: dependencias,
+		timeout:      timeout,
+	}
+}
+
+// VivoHandler responde 200 enquanto o processo estiver no ar, sem verificar dependências.
+func (s *HandlerFactory) VivoHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		escreve(w, http.StatusOK, map[string]string{"status": OK})
+	}
+}
+
+// Encerra passa a reportar o serviço como não pronto, para que o balanceador de carga deixe de enviar requisições
+// enquanto as requisições em andamento terminam.
+func (s *HandlerFactory) Encerra() {
+	atomic.StoreInt32(&s.encerrando, 1)
+}
+
+// ProntoHandler verifica todas as dependências em paralelo. Responde 503 se alguma dependência essencial falhar ou
+// se o serviço estiver sendo encerrado, e 200 caso contrário, com o status de cada dependência.
+func (s *HandlerFactory) ProntoHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		if atomic.LoadInt32(&s.encerrando) == 1 {
+			escreve(w, http.StatusServiceUnavailable, &ProntidaoResposta{Status: ENCERRANDO})
+			return
+		}
+		ctx, cancel := context.WithTimeout(r.Context(), s.timeout)
+		defer cancel()
+
+		resposta := &ProntidaoResposta{Status: OK, Dependencias: make(map[string]*DependenciaResposta)}
+		var mu sync.Mutex
+		var wg sync.WaitGroup
+		for _, d := range s.dependencias {
+			wg.Add(1)
+			go func(d Dependencia) {
+				defer wg.Done()
+				dr := verifica(ctx, d)
+				mu.Lock()
+				resposta.Dependencias[d.Nome] = dr
+				mu.Unlock()
+			}(d)
+		}
+		wg.Wait()
+
+		status := http.StatusOK
+		for _, d := range s.dependencias {
+			if resposta.Dependencias[d.Nome].Status == OK {
+				continue
+			}
+			if d.Essencial {
+				resposta.Status = INDISPONIVEL
+				status = http.StatusServiceUnavailable
+			} else if resposta.Status == OK {
+				resposta.Status = DEGRADADO
+			}
+		}
+		escreve(w, status, resposta)
+	}
+}
+
+func verifica(ctx context.Context, d Dependencia) *DependenciaResposta {
+	inicio := time.Now()
+	err := d.Ping(ctx)
+	dr := &DependenciaResposta{
+		Status:     OK,
+		Essencial:  d.Essencial,
+		LatenciaMS: int64(time.Since(inicio) / time.Millisecond),
+	}
+	if err != nil {
+		log.Printf("Dependência %s indisponível: %q", d.Nome, err)
+		dr.Status = ERRO
+		dr.Erro = err.Error()
+	}
+	return dr
+}
+
+func escreve(w http.ResponseWriter, status int, v interface{}) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		log.Printf("Erro processando verificação de saúde: '%q'\n", err)
+		w.WriteHeader(http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	w.WriteHeader(status)
+	w.Write(b)
+}
@@ -0,0 +1,67 @@
+package sequencias
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/danielfireman/deciframe-api/acorde"
+	"github.com/danielfireman/deciframe-api/db"
+	"github.com/danielfireman/deciframe-api/erro"
+	"github.com/danielfireman/deciframe-api/model"
+	"github.com/danielfireman/deciframe-api/resposta"
+	"github.com/danielfireman/deciframe-api/telemetria"
+	"github.com/julienschmidt/httprouter"
+)
+
+type HandlerFactory struct {
+	mon telemetria.Telemetria
+	db  db.Repositorio
+}
+
+func FabricaDeTratadores(db db.Repositorio, mon telemetria.Telemetria) *HandlerFactory {
+	return &HandlerFactory{
+		mon: mon,
+		db:  db,
+	}
+}
+
+// GetHandler lista as sequências famosas. Se o parâmetro acordes for passado (ex: acordes=A,E,F#m,D), retorna
+// apenas a sequência formada por esses acordes, em qualquer tom, indicando o tom em que foi encontrada.
+func (s *HandlerFactory) GetHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		txn := s.mon.IniciaTransacao("sequencias", w, r)
+		defer txn.Fim()
+
+		buscaSeg := txn.Segmento("busca_sequencias")
+		seqs, err := s.db.BuscaSequencias(r.Context())
+		buscaSeg.Fim()
+		if err != nil {
+			log.Printf("Erro processando request [%s]: '%q'\n", r.URL.String(), err)
+			erro.Escreve(txn, r, erro.Interno(err))
+			return
+		}
+
+		if valor := r.URL.Query().Get("acordes"); valor != "" {
+			// Os acordes são interpretados como em /similares: um acorde inválido é um erro do cliente, e não uma
+			// sequência inexistente.
+			acordes, err := acorde.SeparaEstrito(valor)
+			if err != nil {
+				erro.Escreve(txn, r, erro.ParametroInvalido(
+					fmt.Sprintf("acordes: %v (acordes válidos são como C, F#m7, Bb7M, D/F#)", err),
+					fmt.Sprintf("acordes: invalid chord in %s (valid chords look like C, F#m7, Bb7M, D/F#)", valor)))
+				return
+			}
+			seq, ok := acorde.Identifica(seqs, acordes)
+			if !ok {
+				erro.Escreve(txn, r, erro.NaoEncontrado(
+					"Nenhuma sequência famosa formada pelos acordes: "+valor,
+					"No famous sequence is formed by the chords: "+valor))
+				return
+			}
+			seqs = []*model.Sequencia{seq}
+		}
+
+		resposta.JSON(txn, r, seqs)
+	}
+}
@@ -0,0 +1,245 @@
+package similares
+
+import (
+	"context"
+	"log"
+	"strings"
+
+	"github.com/danielfireman/deciframe-api/acorde"
+	"github.com/danielfireman/deciframe-api/db"
+	"github.com/danielfireman/deciframe-api/erro"
+	"github.com/danielfireman/deciframe-api/indice"
+	"github.com/danielfireman/deciframe-api/model"
+	"github.com/danielfireman/deciframe-api/telemetria"
+	sets "github.com/deckarep/golang-set"
+)
+
+// Número máximo de resultados de uma busca por similares. Apenas estes são materializados, ordenados e colocados
+// no cache; os demais são apenas contados.
+const MAX_RESULTADOS = 1000
+
+// resultado é o que uma busca por similares produz e o que é guardado no cache, de onde as páginas são servidas.
+type resultado struct {
+	Total     int                  `json:"total"`     // Número de músicas que satisfazem a consulta.
+	Respostas []*SimilaresResposta `json:"respostas"` // As até MAX_RESULTADOS mais relevantes, da melhor para a pior.
+}
+
+// busca executa a consulta validada, retornando até MAX_RESULTADOS músicas, das mais para as menos relevantes. É o
+// motor compartilhado por GET e POST /similares.
+func (s *HandlerFactory) busca(ctx context.Context, txn telemetria.Transacao, c *consulta) (*resultado, *erro.Erro) {
+	excluidas, filtro := c.excluidas(), c.filtro()
+	switch c.modo {
+	case ModoSequencia:
+		// Busca sequência famosa.
+		buscaSequencias := txn.Segmento("busca_sequencias")
+		seqs, err := s.db.BuscaSequencias(ctx)
+		buscaSequencias.Fim()
+		if err != nil {
+			return nil, erroInterno(c, err)
+		}
+		// A sequência pode ser informada em qualquer tom.
+		seq, ok := acorde.Identifica(seqs, c.Sequencia)
+		if !ok {
+			return nil, erro.NaoEncontrado(
+				"Nenhuma sequência famosa formada pelos acordes: "+strings.Join(c.Sequencia, ","),
+				"No famous sequence is formed by the chords: "+strings.Join(c.Sequencia, ","))
+		}
+		buscaSeqFamosas := txn.Segmento("busca_seq_famosas")
+		musicasSeqFamosa, err := s.db.BuscaMusicasPorSeqFamosa(ctx, []string{seq.ID}, c.Generos)
+		buscaSeqFamosas.Fim()
+		if err != nil {
+			return nil, erroInterno(c, err)
+		}
+		melhores := indice.NovaSelecao(MAX_RESULTADOS)
+		consulta := novaConsultaTransponivel(c.Sequencia)
+		for _, m := range musicasSeqFamosa {
+			if !excluidas[m.UniqueID] && aceitaEmAlgumTom(filtro, consulta, conjunto(m.Acordes)) {
+				melhores.Adiciona(&indice.Resultado{Musica: m})
+			}
+		}
+		return novoResultado(melhores, func(res *indice.Resultado) *SimilaresResposta {
+			return novaResposta(res.Musica)
+		}), nil
+
+	case ModoProgressao:
+		// Busca por progressão: acordes na ordem, contíguos ou separados por no máximo lacuna acordes.
+		buscaProgressao := txn.Segmento("busca_progressao")
+		musicas, err := s.db.BuscaMusicasPorTodosAcordes(ctx, c.Progressao, c.Generos)
+		buscaProgressao.Fim()
+		if err != nil {
+			return nil, erroInterno(c, err)
+		}
+		var candidatas []*model.Musica
+		consulta := conjunto(c.Progressao)
+		for _, m := range musicas {
+			if !excluidas[m.UniqueID] && filtro.Aceita(consulta, conjunto(m.Acordes)) {
+				candidatas = append(candidatas, m)
+			}
+		}
+		return buscaPorProgressao(candidatas, c.Progressao, *c.Lacuna), nil
+	}
+
+	// Busca similares: por acordes ou por id_unico_musica.
+	acordes, tom := c.Acordes, c.Tom
+	if c.modo == ModoIDUnico {
+		buscaIDUnicoSeg := txn.Segmento("busca_id_unico")
+		m, err := s.db.BuscaMusicaPorIDUnico(ctx, c.IDUnicoMusica)
+		buscaIDUnicoSeg.Fim()
+		if err != nil {
+			if db.NaoEncontrado(err) {
+				return nil, erro.NaoEncontrado(
+					"Música não encontrada: "+c.IDUnicoMusica,
+					"Song not found: "+c.IDUnicoMusica)
+			}
+			return nil, erroInterno(c, err)
+		}
+		acordes, tom = m.Acordes, m.Tom
+	}
+	// Com transpor=true, músicas em qualquer tom são consideradas.
+	var transponivel *consultaTransponivel
+	if c.Transpor {
+		transponivel = novaConsultaTransponivel(acordes)
+	}
+	defer txn.Segmento("busca_similares").Fim()
+	q := indice.Consulta{Acordes: acordes, Generos: c.Generos, Excluir: excluidas, Fatores: fatores(c.Pesos, acordes), Filtro: filtro}
+	if idx := s.indiceAtual(); idx != nil && transponivel == nil {
+		return buscaNoIndice(idx, q, c.criterio), nil
+	}
+	response, err := s.buscaNoRepositorio(ctx, q, tom, transponivel, c.Ordenacao, c.criterio)
+	if err != nil {
+		return nil, erroInterno(c, err)
+	}
+	return response, nil
+}
+
+// erroInterno registra no log o erro do repositório e o converte na resposta ao cliente.
+func erroInterno(c *consulta, err error) *erro.Erro {
+	log.Printf("Erro processando consulta %+v: '%q'\n", c.ConsultaSimilares, err)
+	return erro.Interno(err)
+}
+
+// aceitaEmAlgumTom verifica se a música satisfaz o filtro com a consulta transposta para algum tom. Os acordes
+// novos são mínimos no tom em que a consulta aparece na música, que é o que vale para uma sequência famosa.
+func aceitaEmAlgumTom(f indice.Filtro, c *consultaTransponivel, musica sets.Set) bool {
+	for semitons := 0; semitons < 12; semitons++ {
+		if f.Aceita(c.transpoe(semitons), musica) {
+			return true
+		}
+	}
+	return false
+}
+
+// fatores retorna os pesos informados para os acordes da consulta. Pesos de acordes fora da consulta não têm efeito.
+func fatores(pesos map[string]float64, acordes []string) map[string]float64 {
+	if len(pesos) == 0 {
+		return nil
+	}
+	res := make(map[string]float64)
+	for _, a := range acordes {
+		if p, ok := pesos[a]; ok {
+			res[a] = p
+		}
+	}
+	return res
+}
+
+// buscaNoIndice calcula a similaridade no índice invertido, materializando apenas as MAX_RESULTADOS músicas de
+// maior pontuação.
+func buscaNoIndice(idx *indice.Indice, q indice.Consulta, pontuador Pontuador) *resultado {
+	resultados, total := idx.Busca(q, MAX_RESULTADOS, pontuador.Pontua)
+	consulta := conjunto(q.Acordes)
+	res := &resultado{Total: total}
+	for _, r := range resultados {
+		res.Respostas = append(res.Respostas, respostaSimilar(r, consulta, 0))
+	}
+	return res
+}
+
+// buscaNoRepositorio busca as candidatas no repositório e calcula a similaridade de cada uma delas. Com
+// transposição, os acordes da consulta são transpostos para o tom que melhor casa com cada música.
+func (s *HandlerFactory) buscaNoRepositorio(ctx context.Context, q indice.Consulta, tom string, transponivel *consultaTransponivel, ordenacao string, pontuador Pontuador) (*resultado, error) {
+	pesos, err := s.pesos(ctx, ordenacao)
+	if err != nil {
+		return nil, err
+	}
+	pesos = pesos.Escala(q.Fatores)
+	var musicasSimilares []*model.Musica
+	if transponivel != nil {
+		musicasSimilares, err = s.db.BuscaMusicasPorGraus(ctx, transponivel.graus(tom), q.Generos)
+	} else {
+		musicasSimilares, err = s.db.BuscaMusicasPorAcordes(ctx, q.Acordes, q.Generos)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	acordesSet := conjunto(q.Acordes)
+	// Com transposição, a consulta transposta para cada música é recalculada apenas para as selecionadas.
+	consultaPara := func(mAcordesSet sets.Set) (sets.Set, int) {
+		if transponivel == nil {
+			return acordesSet, 0
+		}
+		semitons, consultaSet := transponivel.melhorTransposicao(mAcordesSet)
+		return consultaSet, semitons
+	}
+	melhores := indice.NovaSelecao(MAX_RESULTADOS)
+	for _, m := range musicasSimilares {
+		mAcordesSet := conjunto(m.Acordes)
+		if mAcordesSet.Cardinality() < 2 || q.Excluir[m.UniqueID] {
+			continue
+		}
+		consultaSet, _ := consultaPara(mAcordesSet)
+		if !q.Filtro.Aceita(consultaSet, mAcordesSet) {
+			continue
+		}
+		comp := indice.Compara(consultaSet, mAcordesSet, pesos)
+		melhores.Adiciona(&indice.Resultado{Musica: m, Comparacao: comp, Pontuacao: pontuador.Pontua(comp)})
+	}
+	return novoResultado(melhores, func(res *indice.Resultado) *SimilaresResposta {
+		consultaSet, semitons := consultaPara(conjunto(res.Musica.Acordes))
+		return respostaSimilar(res, consultaSet, semitons)
+	}), nil
+}
+
+// respostaSimilar monta a resposta de uma busca por semelhança, com os acordes da música fora e dentro da consulta
+// (já transposta pelos semitons informados).
+func respostaSimilar(res *indice.Resultado, consulta sets.Set, semitons int) *SimilaresResposta {
+	musica := conjunto(res.Musica.Acordes)
+	r := novaResposta(res.Musica)
+	r.Diferenca = musica.Difference(consulta).ToSlice()
+	r.Intersecao = musica.Intersect(consulta).ToSlice()
+	r.Pontuacao = res.Pontuacao
+	r.Semitons = semitons
+	return r
+}
+
+// novoResultado esvazia a seleção, montando a resposta de cada música selecionada, da melhor para a pior.
+func novoResultado(melhores *indice.Selecao, resposta func(*indice.Resultado) *SimilaresResposta) *resultado {
+	res := &resultado{Total: melhores.Total()}
+	for _, r := range melhores.Ordenados() {
+		res.Respostas = append(res.Respostas, resposta(r))
+	}
+	return res
+}
+
+func novaResposta(m *model.Musica) *SimilaresResposta {
+	return &SimilaresResposta{
+		UniqueID:     m.UniqueID,
+		IDArtista:    m.IDArtista,
+		ID:           m.ID,
+		Artista:      m.Artista,
+		Nome:         m.Nome,
+		Popularidade: m.Popularidade,
+		Acordes:      m.Acordes,
+		Genero:       m.Genero,
+		URL:          m.URL,
+	}
+}
+
+func conjunto(valores []string) sets.Set {
+	s := sets.NewThreadUnsafeSet()
+	for _, v := range valores {
+		s.Add(v)
+	}
+	return s
+}
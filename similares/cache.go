@@ -0,0 +1,52 @@
+package similares
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/danielfireman/deciframe-api/cache"
+	"github.com/danielfireman/deciframe-api/telemetria"
+)
+
+const (
+	PREFIXO_CACHE = "similares:v2:" // Entradas de versões anteriores guardavam apenas as respostas.
+	EXPIRACAO     = 6 * time.Hour   // Valor padrão de Config.Expiracao.
+)
+
+// chave retorna a chave da consulta no cache: o hash SHA-256 da consulta normalizada em JSON. Como a normalização
+// descarta as opções de paginação, canonicaliza os acordes e ordena os conjuntos, consultas equivalentes (por GET
+// ou POST) compartilham a mesma entrada no cache, independente da página pedida.
+func (c *consulta) chave() (string, error) {
+	b, err := json.Marshal(c.ConsultaSimilares)
+	if err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("%s%x", PREFIXO_CACHE, sha256.Sum256(b)), nil
+}
+
+func (s *HandlerFactory) buscaNoCache(ctx context.Context, chave string, txn telemetria.Transacao) (*resultado, bool) {
+	defer txn.Segmento("busca_cache").Fim()
+	response := &resultado{}
+	if err := s.cache.Get(ctx, chave, response); err != nil {
+		if err != cache.ErrCacheMiss {
+			log.Printf("Erro buscando no cache: %q", err)
+		}
+		txn.Cache(false)
+		return nil, false
+	}
+	txn.Cache(true)
+	return response, true
+}
+
+func (s *HandlerFactory) colocaNoCache(ctx context.Context, chave string, response *resultado) {
+	if len(response.Respostas) == 0 {
+		return
+	}
+	if err := s.cache.Set(ctx, chave, response, s.cfg.Expiracao); err != nil {
+		log.Printf("Erro colocando no cache: %q", err)
+	}
+}
@@ -3,20 +3,19 @@ package similares
 import (
 	"encoding/json"
 	"fmt"
+	"io"
 	"log"
-	"math"
 	"net/http"
-	"sort"
-	"strconv"
-	"strings"
 	"time"
 
-	"gopkg.in/go-redis/cache.v4"
-
+	"github.com/danielfireman/deciframe-api/cache"
 	"github.com/danielfireman/deciframe-api/db"
-	sets "github.com/deckarep/golang-set"
+	"github.com/danielfireman/deciframe-api/erro"
+	"github.com/danielfireman/deciframe-api/indice"
+	"github.com/danielfireman/deciframe-api/limite"
+	"github.com/danielfireman/deciframe-api/resposta"
+	"github.com/danielfireman/deciframe-api/telemetria"
 	"github.com/julienschmidt/httprouter"
-	"github.com/newrelic/go-agent"
 )
 
 type SimilaresResposta struct {
@@ -31,260 +30,195 @@ type SimilaresResposta struct {
 	URL          string        `json:"url"`
 	Diferenca    []interface{} `json:"diferenca,omitempty"`
 	Intersecao   []interface{} `json:"intersecao,omitempty"`
+	Pontuacao    float64       `json:"pontuacao"`
+	Semitons     int           `json:"semitons,omitempty"` // Transposição aplicada à consulta (transpor=true).
+	Cifra        []string      `json:"cifra,omitempty"`
+	Posicoes     []int         `json:"posicoes,omitempty"` // Posições na cifra onde a progressão começa.
 }
 
-// PorMenorDiferenca implementa sort.Interface for []*Musica baseado no campo Diferenca
-type PorMenorDiferenca []*SimilaresResposta
-
-func (p PorMenorDiferenca) Len() int {
-	return len(p)
-}
-func (p PorMenorDiferenca) Swap(i, j int) {
-	p[i], p[j] = p[j], p[i]
+// Config ajusta a paginação e o cache de /similares. Campos não positivos assumem os valores padrão TAM_PAGINA,
+// MAX_TAM_PAGINA e EXPIRACAO.
+type Config struct {
+	TamPagina    int
+	MaxTamPagina int
+	Expiracao    time.Duration // Tempo que o resultado completo de uma consulta permanece no cache.
 }
-func (p PorMenorDiferenca) Less(i, j int) bool {
-	return len(p[i].Diferenca) < len(p[j].Diferenca)
-}
-
-const (
-	NUM_ACESSOS_CONCORRENTES = 5
-	TAM_PAGINA               = 100
-)
 
 type HandlerFactory struct {
-	mon   newrelic.Application
-	fila  chan struct{}
-	db    *db.DB
-	cache *cache.Codec
+	mon       telemetria.Telemetria
+	cfg       Config
+	limitador *limite.Limitador
+	db        db.Repositorio
+	cache     cache.Cache
+	idf       *cachePesosIDF
+	indice    *indice.Atualizado
 }
 
-func FabricaDeTratadores(db *db.DB, cache *cache.Codec, mon newrelic.Application) *HandlerFactory {
+// FabricaDeTratadores cria os tratadores de /similares. Se idx não for nil, as buscas por acordes sem transposição
+// são feitas no índice invertido em memória em vez do repositório. Requisições respondidas pelo cache não passam
+// pelo limitador.
+func FabricaDeTratadores(db db.Repositorio, cache cache.Cache, idx *indice.Atualizado, limitador *limite.Limitador, cfg Config, mon telemetria.Telemetria) *HandlerFactory {
+	if cfg.TamPagina <= 0 {
+		cfg.TamPagina = TAM_PAGINA
+	}
+	if cfg.MaxTamPagina <= 0 {
+		cfg.MaxTamPagina = MAX_TAM_PAGINA
+	}
+	if cfg.Expiracao <= 0 {
+		cfg.Expiracao = EXPIRACAO
+	}
 	return &HandlerFactory{
-		mon:   mon,
-		db:    db,
-		fila:  make(chan struct{}, NUM_ACESSOS_CONCORRENTES),
-		cache: cache,
+		mon:       mon,
+		cfg:       cfg,
+		limitador: limitador,
+		db:        db,
+		cache:     cache,
+		idf:       &cachePesosIDF{carrega: db.FrequenciaAcordes},
+		indice:    idx,
 	}
 }
 
-var sequencias = map[string][]string{
-	"BmGDA":   []string{"0"},
-	"CGAmF":   []string{"1"},
-	"EmG":     []string{"2"},
-	"CA7DmG7": []string{"3"},
-	"GmF":     []string{"4"},
-	"CC7FFm":  []string{"5"},
+func (s *HandlerFactory) indiceAtual() *indice.Indice {
+	if s.indice == nil {
+		return nil
+	}
+	return s.indice.Indice()
 }
 
+// GetHandler busca músicas de acordo com exatamente um dos modos de busca:
+//
+//	acordes=C,G,Am,F        músicas com acordes em comum, das mais para as menos similares.
+//	id_unico_musica=ID      músicas similares à música informada, que é excluída dos resultados.
+//	sequencia=C,G,Am,F      músicas que contêm a sequência famosa formada pelos acordes, em qualquer tom.
+//	progressao=Am,F,C       músicas em que os acordes aparecem nessa ordem.
+//
+// Listas de acordes têm entre 1 e MAX_ACORDES acordes válidos para acorde.Parse, separados por vírgula. Os demais
+// parâmetros são opcionais:
+//
+//	generos=rock,samba      até MAX_GENEROS gêneros, como listados por /generos.
+//	excluir=ID1,ID2         até MAX_EXCLUIR músicas a ignorar.
+//	obrigatorios=C,G        acordes que as músicas devem conter.
+//	proibidos=F#,Bb         acordes que as músicas não podem conter.
+//	max_novos=2             número máximo de acordes das músicas fora dos acordes da consulta.
+//	ordenacao=              diferenca (padrão), jaccard, sobreposicao ou idf. Apenas para acordes e id_unico_musica.
+//	transpor=true|false     considera músicas em qualquer tom. Apenas para acordes e id_unico_musica.
+//	tom=G                   tom dos acordes da consulta. Apenas para acordes com transpor=true.
+//	lacuna=0..MAX_LACUNA    acordes permitidos entre os da progressão. Apenas para progressao.
+//	pagina=1, tamanho=N     paginação, com tamanho até Config.MaxTamPagina.
+//
+// obrigatorios e proibidos não podem ser usados com transpor. Como a sequência pode ser informada em qualquer tom,
+// com sequencia max_novos conta os acordes da música fora da sequência no tom em que ela aparece. Apenas os
+// MAX_RESULTADOS resultados mais relevantes são paginados: total conta todas as músicas encontradas e truncado
+// indica que as demais foram omitidas. Parâmetros inválidos ou combinados de forma inválida são respondidos com 400
+// e o motivo.
 func (s *HandlerFactory) GetHandler() httprouter.Handle {
 	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
-		txn := s.mon.StartTransaction("similares", w, r)
-		defer txn.End()
-
-		// Controlando acesso concorrente;
-		filaSeg := newrelic.StartSegment(txn, "fila")
-		s.fila <- struct{}{}
-		defer func() {
-			<-s.fila
-		}()
-		filaSeg.End()
+		txn := s.mon.IniciaTransacao("similares", w, r)
+		defer txn.Fim()
 
-		pagina, err := paginaRequisitada(r)
-		if err != nil {
-			txn.WriteHeader(http.StatusBadRequest)
+		pagina, e := paginaRequisitada(r, s.cfg)
+		if e != nil {
+			erro.Escreve(txn, r, e)
 			return
 		}
-
-		// Busca no cache.
-		response := s.buscaNoCache(r.URL.RawQuery, txn)
-		if len(response) > 0 {
-			b, err := marshal(response, pagina, txn)
-			if err != nil {
-				log.Printf("Erro processando request [%s]: '%q'", r.URL.String(), err)
-				txn.WriteHeader(http.StatusInternalServerError)
-				return
-			}
-			txn.Header().Add("Access-Control-Allow-Origin", "*")
-			fmt.Fprintf(txn, b)
+		q, e := consultaDaURL(r.URL.Query())
+		if e != nil {
+			erro.Escreve(txn, r, e)
 			return
 		}
+		s.atende(txn, r, q, pagina, linkDaURL(r))
+	}
+}
 
-		// Busca sequência famosa.
-		queryValues := r.URL.Query()
-		if queryValues.Get("sequencia") != "" {
-			acordes := strings.Replace(queryValues.Get("sequencia"), ",", "", -1)
-			var response []*SimilaresResposta
-			idSeq, ok := sequencias[acordes]
-			if ok {
-				buscaSeqFamosas := newrelic.StartSegment(txn, "busca_seq_famosas")
-				musicasSeqFamosa, err := s.db.BuscaMusicasPorSeqFamosa(idSeq, generosRequisitados(r))
-				if err != nil {
-					log.Printf("Erro processando request [%s]: '%q'\n", r.URL.String(), err)
-					txn.WriteHeader(http.StatusInternalServerError)
-					return
-				}
-				buscaSeqFamosas.End()
-				for _, m := range musicasSeqFamosa {
-					response = append(response, &SimilaresResposta{
-						UniqueID:     m.UniqueID,
-						IDArtista:    m.IDArtista,
-						ID:           m.ID,
-						Artista:      m.Artista,
-						Nome:         m.Nome,
-						Popularidade: m.Popularidade,
-						Acordes:      m.Acordes,
-						Genero:       m.Genero,
-						URL:          m.URL,
-					})
-				}
-				b, err := s.toBytes(r.URL.RawQuery, response, pagina)
-				if err != nil {
-					log.Printf("Erro processando request [%s]: '%q'\n", r.URL.String(), err)
-					txn.WriteHeader(http.StatusInternalServerError)
-					return
-				}
-				txn.Header().Add("Access-Control-Allow-Origin", "*")
-				fmt.Fprintf(txn, string(b))
-				return
-			}
-		}
-
-		// Busca similares: por acordes ou por id_unico_musica.
-		var acordes []string
-		switch {
-		case queryValues.Get("acordes") != "":
-			acordes = strings.Split(queryValues.Get("acordes"), ",")
-		case queryValues.Get("id_unico_musica") != "":
-			buscaIDUnicoSeg := newrelic.StartSegment(txn, "busca_id_unico")
-			m, err := s.db.BuscaMusicaPorIDUnico(queryValues.Get("id_unico_musica"))
-			buscaIDUnicoSeg.End()
-			if err != nil {
-				if db.NaoEncontrado(err) {
-					txn.WriteHeader(http.StatusBadRequest)
-					return
-				}
-				txn.WriteHeader(http.StatusInternalServerError)
-				return
-			}
-			for _, a := range m.Acordes {
-				acordes = append(acordes, a)
-			}
-		}
-		buscaSimilares := newrelic.StartSegment(txn, "busca_similares")
-		musicasSimilares, err := s.db.BuscaMusicasPorAcordes(acordes, generosRequisitados(r))
-		if err != nil {
-			log.Printf("Erro processando request [%s]: '%q'\n", r.URL.String(), err)
-			txn.WriteHeader(http.StatusInternalServerError)
+// PostHandler recebe a consulta como JSON no corpo da requisição (ConsultaSimilares), com as mesmas opções de
+// GetHandler. Listas de acordes são arrays. Além delas, aceita pesos (acorde -> peso entre 0 e MAX_PESO, com
+// ordenacao=idf) e pagina e tamanho no próprio corpo. Consultas equivalentes por GET e POST compartilham o cache.
+func (s *HandlerFactory) PostHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		txn := s.mon.IniciaTransacao("similares_post", w, r)
+		defer txn.Fim()
+
+		var q ConsultaSimilares
+		dec := json.NewDecoder(http.MaxBytesReader(txn, r.Body, MAX_TAM_CORPO))
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&q); err != nil {
+			erro.Escreve(txn, r, erro.ParametroInvalido(
+				fmt.Sprintf("Corpo da requisição inválido, esperado um JSON de até %d bytes: %v", MAX_TAM_CORPO, err),
+				fmt.Sprintf("Invalid request body, expected a JSON of at most %d bytes: %v", MAX_TAM_CORPO, err)))
 			return
 		}
-		buscaSimilares.End()
-
-		acordesSet := sets.NewThreadUnsafeSet()
-		for _, a := range acordes {
-			acordesSet.Add(a)
-		}
-		for _, m := range musicasSimilares {
-			mAcordesSet := sets.NewThreadUnsafeSet()
-			for _, a := range m.Acordes {
-				mAcordesSet.Add(a)
-			}
-			if mAcordesSet.Cardinality() > 1 && queryValues.Get("id_unico_musica") != m.UniqueID {
-				response = append(response, &SimilaresResposta{
-					UniqueID:     m.UniqueID,
-					IDArtista:    m.IDArtista,
-					ID:           m.ID,
-					Artista:      m.Artista,
-					Nome:         m.Nome,
-					Popularidade: m.Popularidade,
-					Acordes:      m.Acordes,
-					Genero:       m.Genero,
-					URL:          m.URL,
-					Diferenca:    mAcordesSet.Difference(acordesSet).ToSlice(),
-					Intersecao:   mAcordesSet.Intersect(acordesSet).ToSlice(),
-				})
-			}
+		// O corpo deve conter apenas a consulta.
+		if dec.Decode(&struct{}{}) != io.EOF {
+			erro.Escreve(txn, r, erro.ParametroInvalido(
+				"Corpo da requisição inválido: há dados após o JSON da consulta.",
+				"Invalid request body: there is data after the query JSON."))
+			return
 		}
-		sort.Sort(PorMenorDiferenca(response))
-		b, err := s.toBytes(r.URL.RawQuery, response, pagina)
-		if err != nil {
-			log.Printf("Erro processando request [%s]: '%q'\n", r.URL.String(), err)
-			txn.WriteHeader(http.StatusInternalServerError)
+		pagina, e := paginaDoCorpo(&q, s.cfg)
+		if e != nil {
+			erro.Escreve(txn, r, e)
 			return
 		}
-		txn.Header().Add("Access-Control-Allow-Origin", "*")
-		fmt.Fprintf(txn, string(b))
+		s.atende(txn, r, &q, pagina, nil)
 	}
 }
 
-func (s *HandlerFactory) buscaNoCache(query string, txn newrelic.Transaction) []*SimilaresResposta {
-	defer newrelic.StartSegment(txn, "busca_cache").End()
-	var response []*SimilaresResposta
-	if err := s.cache.Get(query, &response); err != nil && err != cache.ErrCacheMiss {
-		log.Printf("Erro buscando no cache: %q", err)
-		return []*SimilaresResposta{} // Garantir que mandamos uma lista vazia.
+// atende valida a consulta e responde a página pedida, buscando primeiro no cache. Requisições respondidas pelo
+// cache não passam pelo limitador.
+func (s *HandlerFactory) atende(txn telemetria.Transacao, r *http.Request, q *ConsultaSimilares, pagina paginacao, link func(int) string) {
+	c, e := q.valida()
+	if e != nil {
+		erro.Escreve(txn, r, e)
+		return
 	}
-	return response
-}
-
-func marshal(response []*SimilaresResposta, pagina int, txn newrelic.Transaction) (string, error) {
-	defer newrelic.StartSegment(txn, "marshal").End()
-
-	// Consideramos os limites da página.
-	i, f := limitesDaPagina(len(response), pagina)
-
-	// Convertemos para JSON.
-	b, err := json.Marshal(response[i:f])
+	chave, err := c.chave()
 	if err != nil {
-		return "", err
+		log.Printf("Erro processando request [%s]: '%q'\n", r.URL.String(), err)
+		erro.Escreve(txn, r, erro.Interno(err))
+		return
 	}
-	return string(b), nil
-}
 
-func (s *HandlerFactory) toBytes(cacheKey string, response []*SimilaresResposta, pagina int) ([]byte, error) {
-	// Consideramos os limites da página.
-	i, f := limitesDaPagina(len(response), pagina)
+	response, ok := s.buscaNoCache(r.Context(), chave, txn)
+	if !ok {
+		// Controlando acesso concorrente e por cliente.
+		filaSeg := txn.Segmento("fila")
+		libera, err := s.limitador.Entra(r)
+		filaSeg.Fim()
+		if recusa, ok := err.(*limite.Recusa); ok {
+			recusa.Escreve(txn, r)
+			return
+		}
+		if err != nil {
+			erro.Escreve(txn, r, erro.Interno(err))
+			return
+		}
+		defer libera()
 
-	// Colocamos no cache.
-	if len(response) > 0 {
-		s.cache.Set(&cache.Item{
-			Key:        cacheKey,
-			Object:     response[i:f],
-			Expiration: 6 * time.Hour,
-		})
+		if response, e = s.busca(r.Context(), txn, c); e != nil {
+			erro.Escreve(txn, r, e)
+			return
+		}
+		// Colocamos no cache o resultado completo, de onde todas as páginas da consulta serão servidas.
+		s.colocaNoCache(r.Context(), chave, response)
 	}
 
-	// Convertemos para JSON.
-	b, err := json.Marshal(response[i:f])
+	b, err := marshal(novaPagina(response, pagina, link), txn)
 	if err != nil {
-		return nil, err
+		log.Printf("Erro processando request [%s]: '%q'\n", r.URL.String(), err)
+		erro.Escreve(txn, r, erro.Interno(err))
+		return
 	}
-	return b, nil
-}
-
-func limitesDaPagina(size int, pagina int) (int, int) {
-	i := (pagina - 1) * TAM_PAGINA
-	return i, int(math.Max(0, math.Min(float64(i+TAM_PAGINA), float64(size))))
+	resposta.Escreve(txn, b)
 }
 
-func paginaRequisitada(r *http.Request) (int, error) {
-	pagina := 1
-	if r.URL.Query().Get("pagina") != "" {
-		p, err := strconv.Atoi(r.URL.Query().Get("pagina"))
-		if err != nil {
-			return -1, err
-		}
-		pagina = p
-	}
-	return pagina, nil
-}
-
-// retorna generos do request (podem ser separados por vírgula).
-func generosRequisitados(r *http.Request) []string {
-	var res []string
-	if r.URL.Query().Get("generos") != "" {
-		for _, g := range strings.Split(r.URL.Query().Get("generos"), ",") {
-			res = append(res, g)
-		}
+// OptionsHandler responde as requisições de preflight dos navegadores, necessárias para POST com corpo JSON a
+// partir de outras origens.
+func (s *HandlerFactory) OptionsHandler() httprouter.Handle {
+	return func(w http.ResponseWriter, r *http.Request, p httprouter.Params) {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, X-Request-Id")
+		w.Header().Set("Access-Control-Max-Age", "86400")
+		w.WriteHeader(http.StatusNoContent)
 	}
-	return res
 }
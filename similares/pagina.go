@@ -0,0 +1,145 @@
+package similares
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/danielfireman/deciframe-api/erro"
+	"github.com/danielfireman/deciframe-api/telemetria"
+)
+
+// Valores padrão de Config.TamPagina e Config.MaxTamPagina.
+const (
+	TAM_PAGINA     = 100
+	MAX_TAM_PAGINA = 500
+)
+
+// PaginaResposta é o envelope das respostas de /similares.
+type PaginaResposta struct {
+	Total      int                  `json:"total"`              // Número de músicas que satisfazem a consulta.
+	Truncado   bool                 `json:"truncado,omitempty"` // Se apenas as MAX_RESULTADOS primeiras são paginadas.
+	Pagina     int                  `json:"pagina"`             // Página atual, começando de 1.
+	Tamanho    int                  `json:"tamanho"`            // Número máximo de resultados por página.
+	Proxima    string               `json:"proxima,omitempty"`  // Links para as páginas vizinhas, apenas em GET.
+	Anterior   string               `json:"anterior,omitempty"`
+	Resultados []*SimilaresResposta `json:"resultados"`
+}
+
+type paginacao struct {
+	pagina  int
+	tamanho int
+}
+
+// paginaRequisitada lê os parâmetros pagina e tamanho, retornando um erro de parâmetro inválido com o motivo.
+func paginaRequisitada(r *http.Request, cfg Config) (paginacao, *erro.Erro) {
+	var pagina, tamanho int
+	var err error
+	if r.URL.Query().Get("pagina") != "" {
+		if pagina, err = strconv.Atoi(r.URL.Query().Get("pagina")); err != nil {
+			return paginacao{}, erroPagina(r.URL.Query().Get("pagina"))
+		}
+	}
+	if r.URL.Query().Get("tamanho") != "" {
+		if tamanho, err = strconv.Atoi(r.URL.Query().Get("tamanho")); err != nil {
+			return paginacao{}, erroTamanho(r.URL.Query().Get("tamanho"), cfg)
+		}
+	}
+	return novaPaginacao(r.URL.Query().Get("pagina") != "", pagina, r.URL.Query().Get("tamanho") != "", tamanho, cfg)
+}
+
+// paginaDoCorpo lê as opções pagina e tamanho do corpo de POST /similares. Valores ausentes (zero) assumem os
+// padrões.
+func paginaDoCorpo(q *ConsultaSimilares, cfg Config) (paginacao, *erro.Erro) {
+	return novaPaginacao(q.Pagina != 0, q.Pagina, q.Tamanho != 0, q.Tamanho, cfg)
+}
+
+func novaPaginacao(temPagina bool, pagina int, temTamanho bool, tamanho int, cfg Config) (paginacao, *erro.Erro) {
+	p := paginacao{pagina: 1, tamanho: cfg.TamPagina}
+	if temPagina {
+		if pagina < 1 {
+			return p, erroPagina(strconv.Itoa(pagina))
+		}
+		p.pagina = pagina
+	}
+	if temTamanho {
+		if tamanho < 1 || tamanho > cfg.MaxTamPagina {
+			return p, erroTamanho(strconv.Itoa(tamanho), cfg)
+		}
+		p.tamanho = tamanho
+	}
+	return p, nil
+}
+
+func erroPagina(valor string) *erro.Erro {
+	return erro.ParametroInvalido(
+		fmt.Sprintf("pagina deve ser um inteiro maior que zero: %s", valor),
+		fmt.Sprintf("pagina must be an integer greater than zero: %s", valor))
+}
+
+func erroTamanho(valor string, cfg Config) *erro.Erro {
+	return erro.ParametroInvalido(
+		fmt.Sprintf("tamanho deve ser um inteiro entre 1 e %d: %s", cfg.MaxTamPagina, valor),
+		fmt.Sprintf("tamanho must be an integer between 1 and %d: %s", cfg.MaxTamPagina, valor))
+}
+
+// limites retorna os índices de início e fim da página. Páginas além do fim dos resultados são vazias.
+func (p paginacao) limites(total int) (int, int) {
+	i := (p.pagina - 1) * p.tamanho
+	if i > total {
+		i = total
+	}
+	f := i + p.tamanho
+	if f > total {
+		f = total
+	}
+	return i, f
+}
+
+// novaPagina recorta a página dos resultados. Se link não for nil, as páginas próxima e anterior são preenchidas
+// com os links retornados por ele. Apenas as respostas materializadas são paginadas: se a busca foi truncada em
+// MAX_RESULTADOS, as páginas seguintes são vazias.
+func novaPagina(res *resultado, p paginacao, link func(pagina int) string) *PaginaResposta {
+	response := res.Respostas
+	i, f := p.limites(len(response))
+	pagina := &PaginaResposta{
+		Total:      res.Total,
+		Truncado:   res.Total > len(response),
+		Pagina:     p.pagina,
+		Tamanho:    p.tamanho,
+		Resultados: response[i:f],
+	}
+	if pagina.Resultados == nil {
+		pagina.Resultados = []*SimilaresResposta{}
+	}
+	if link == nil {
+		return pagina
+	}
+	if f < len(response) {
+		pagina.Proxima = link(p.pagina + 1)
+	}
+	if p.pagina > 1 {
+		// A página anterior de uma página além do fim é a última página com resultados.
+		anterior := p.pagina - 1
+		if ultima := (len(response) + p.tamanho - 1) / p.tamanho; anterior > ultima && ultima > 0 {
+			anterior = ultima
+		}
+		pagina.Anterior = link(anterior)
+	}
+	return pagina
+}
+
+// linkDaURL retorna uma função que gera a URL da requisição (relativa ao servidor) apontando para outra página.
+func linkDaURL(r *http.Request) func(pagina int) string {
+	return func(pagina int) string {
+		q := r.URL.Query()
+		q.Set("pagina", strconv.Itoa(pagina))
+		return r.URL.Path + "?" + q.Encode()
+	}
+}
+
+func marshal(pagina *PaginaResposta, txn telemetria.Transacao) ([]byte, error) {
+	defer txn.Segmento("marshal").Fim()
+	return json.Marshal(pagina)
+}
@@ -0,0 +1,162 @@
+package similares
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"math"
+	"sync"
+	"time"
+
+	"github.com/danielfireman/deciframe-api/erro"
+	"github.com/danielfireman/deciframe-api/indice"
+)
+
+// Pontuador calcula o quão similar uma música é dos acordes da consulta. Quanto maior a pontuação, mais similar.
+type Pontuador interface {
+	Pontua(c indice.Comparacao) float64
+}
+
+// PontuadorFunc permite usar funções comuns como Pontuador.
+type PontuadorFunc func(c indice.Comparacao) float64
+
+func (f PontuadorFunc) Pontua(c indice.Comparacao) float64 {
+	return f(c)
+}
+
+const (
+	OrdenacaoDiferenca    = "diferenca"
+	OrdenacaoJaccard      = "jaccard"
+	OrdenacaoSobreposicao = "sobreposicao"
+	OrdenacaoIDF          = "idf"
+
+	// Intervalo entre atualizações dos pesos IDF dos acordes.
+	ATUALIZACAO_PESOS = 6 * time.Hour
+	// Prazo da carga dos pesos IDF, que percorre todo o catálogo.
+	TIMEOUT_PESOS = time.Minute
+)
+
+// PorDiferenca reproduz a ordenação original: quanto menos acordes a música tem fora da consulta, melhor. A negação
+// é feita no inteiro para que nenhuma diferença seja pontuada 0, e não -0.
+var PorDiferenca = PontuadorFunc(func(c indice.Comparacao) float64 {
+	return float64(-c.Diferenca())
+})
+
+// PorJaccard pontua pela razão entre a interseção e a união dos conjuntos de acordes.
+var PorJaccard = PontuadorFunc(func(c indice.Comparacao) float64 {
+	uniao := c.Consulta + c.Musica - c.Intersecao
+	if uniao == 0 {
+		return 0
+	}
+	return float64(c.Intersecao) / float64(uniao)
+})
+
+// PorSobreposicao pontua pelo coeficiente de sobreposição: interseção dividida pelo menor dos conjuntos.
+var PorSobreposicao = PontuadorFunc(func(c indice.Comparacao) float64 {
+	menor := int(math.Min(float64(c.Musica), float64(c.Consulta)))
+	if menor == 0 {
+		return 0
+	}
+	return float64(c.Intersecao) / float64(menor)
+})
+
+// PorIDF é um Jaccard ponderado, onde cada acorde pesa o inverso de sua frequência no catálogo. Desta forma,
+// compartilhar acordes raros conta mais que compartilhar acordes comuns como C ou G.
+var PorIDF = PontuadorFunc(func(c indice.Comparacao) float64 {
+	uniao := c.PesoConsulta + c.PesoMusica - c.PesoIntersecao
+	if uniao == 0 {
+		return 0
+	}
+	return c.PesoIntersecao / uniao
+})
+
+// cachePesosIDF mantém os pesos IDF em memória, recalculando-os periodicamente. A carga é feita em segundo plano,
+// com contexto e prazo próprios, para que o cancelamento ou o prazo da requisição que a iniciou não a interrompa e
+// não propague o erro às demais requisições que a aguardam. Enquanto ela acontece, as requisições usam os pesos
+// anteriores ou, se ainda não há pesos, aguardam o seu fim (ou o fim do próprio contexto).
+type cachePesosIDF struct {
+	mu         sync.Mutex
+	pesos      *indice.PesosIDF
+	atualizado time.Time
+	carga      *cargaPesos // Carga em andamento; nil se não há carga em andamento.
+	carrega    func(ctx context.Context) (map[string]int, int, error)
+}
+
+type cargaPesos struct {
+	fim chan struct{} // Fechado ao fim da carga.
+	err error         // Erro da carga, válido depois de fim ser fechado.
+}
+
+func (c *cachePesosIDF) get(ctx context.Context) (*indice.PesosIDF, error) {
+	c.mu.Lock()
+	if c.pesos != nil && time.Since(c.atualizado) < ATUALIZACAO_PESOS {
+		pesos := c.pesos
+		c.mu.Unlock()
+		return pesos, nil
+	}
+	if c.carga == nil {
+		c.carga = &cargaPesos{fim: make(chan struct{})}
+		go c.executa(c.carga)
+	}
+	carga, pesos := c.carga, c.pesos
+	c.mu.Unlock()
+	if pesos != nil {
+		return pesos, nil
+	}
+	select {
+	case <-carga.fim:
+		if carga.err != nil {
+			return nil, carga.err
+		}
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		return c.pesos, nil
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	}
+}
+
+// executa carrega os pesos. Se a carga falhar, os pesos anteriores (se houver) continuam em uso e a próxima
+// requisição inicia uma nova carga.
+func (c *cachePesosIDF) executa(carga *cargaPesos) {
+	ctx, cancel := context.WithTimeout(context.Background(), TIMEOUT_PESOS)
+	defer cancel()
+	freq, total, err := c.carrega(ctx)
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.carga = nil
+	carga.err = err
+	if err == nil {
+		c.pesos = indice.NovosPesosIDF(freq, total)
+		c.atualizado = time.Now()
+	} else {
+		log.Printf("Erro carregando pesos IDF: %q", err)
+	}
+	close(carga.fim)
+}
+
+// pontuador retorna o Pontuador correspondente ao nome da ordenação. O padrão é OrdenacaoDiferenca.
+func pontuador(ordenacao string) (Pontuador, *erro.Erro) {
+	switch ordenacao {
+	case "", OrdenacaoDiferenca:
+		return PorDiferenca, nil
+	case OrdenacaoJaccard:
+		return PorJaccard, nil
+	case OrdenacaoSobreposicao:
+		return PorSobreposicao, nil
+	case OrdenacaoIDF:
+		return PorIDF, nil
+	}
+	return nil, erro.ParametroInvalido(
+		fmt.Sprintf("ordenacao deve ser %s, %s, %s ou %s: %s", OrdenacaoDiferenca, OrdenacaoJaccard, OrdenacaoSobreposicao, OrdenacaoIDF, ordenacao),
+		fmt.Sprintf("ordenacao must be %s, %s, %s or %s: %s", OrdenacaoDiferenca, OrdenacaoJaccard, OrdenacaoSobreposicao, OrdenacaoIDF, ordenacao))
+}
+
+// pesos retorna os pesos IDF necessários à ordenação, ou nil se a ordenação não os usa.
+func (s *HandlerFactory) pesos(ctx context.Context, ordenacao string) (*indice.PesosIDF, error) {
+	if ordenacao != OrdenacaoIDF {
+		return nil, nil
+	}
+	return s.idf.get(ctx)
+}
@@ -0,0 +1,67 @@
+package similares
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/danielfireman/deciframe-api/indice"
+)
+
+func TestPorDiferenca_SemDiferenca(t *testing.T) {
+	r := SimilaresResposta{Pontuacao: PorDiferenca.Pontua(indice.Comparacao{Intersecao: 3, Consulta: 3, Musica: 3})}
+	b, err := json.Marshal(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(b), `"pontuacao":0`) {
+		t.Errorf("json.Marshal(%+v) = %s, want pontuacao 0", r, b)
+	}
+}
+
+func TestCachePesosIDF_CargaIndependeDaRequisicao(t *testing.T) {
+	libera := make(chan struct{})
+	cargas := 0
+	c := &cachePesosIDF{carrega: func(ctx context.Context) (map[string]int, int, error) {
+		cargas++
+		select {
+		case <-libera:
+			return map[string]int{"C": 1}, 2, nil
+		case <-ctx.Done():
+			return nil, 0, ctx.Err()
+		}
+	}}
+
+	// A requisição que inicia a carga desiste antes do seu fim.
+	ctx, cancela := context.WithCancel(context.Background())
+	cancela()
+	if _, err := c.get(ctx); err != context.Canceled {
+		t.Fatalf("get(cancelado) = %v, want %v", err, context.Canceled)
+	}
+
+	// A carga continua e atende a próxima requisição.
+	close(libera)
+	pesos, err := c.get(context.Background())
+	if err != nil {
+		t.Fatalf("get() = %v", err)
+	}
+	if got, want := pesos.Peso("C"), math.Log(3.0/2.0); got != want {
+		t.Errorf("Peso(C) = %v, want %v", got, want)
+	}
+	if _, err := c.get(context.Background()); err != nil || cargas != 1 {
+		t.Errorf("get() = %v depois de %d cargas, want nil depois de 1", err, cargas)
+	}
+}
+
+func TestCachePesosIDF_ErroNaCarga(t *testing.T) {
+	errCarga := errors.New("repositório indisponível")
+	c := &cachePesosIDF{carrega: func(ctx context.Context) (map[string]int, int, error) {
+		return nil, 0, errCarga
+	}}
+	if _, err := c.get(context.Background()); err != errCarga {
+		t.Errorf("get() = %v, want %v", err, errCarga)
+	}
+}
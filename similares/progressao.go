@@ -0,0 +1,65 @@
+package similares
+
+import (
+	"github.com/danielfireman/deciframe-api/indice"
+	"github.com/danielfireman/deciframe-api/model"
+)
+
+// Número máximo de acordes que podem aparecer entre dois acordes consecutivos da progressão (parâmetro lacuna).
+const MAX_LACUNA = 4
+
+// ocorrencias retorna as posições na cifra onde a progressão começa. Entre dois acordes consecutivos da progressão
+// podem existir até lacuna outros acordes; repetições do acorde anterior não contam como lacuna. Repetições do
+// primeiro acorde formam uma única ocorrência, que começa na primeira delas.
+func ocorrencias(cifra, progressao []string, lacuna int) []int {
+	var posicoes []int
+	for i := range cifra {
+		if i > 0 && cifra[i] == cifra[i-1] {
+			continue
+		}
+		if cifra[i] == progressao[0] && casa(cifra, progressao, i, lacuna) {
+			posicoes = append(posicoes, i)
+		}
+	}
+	return posicoes
+}
+
+func casa(cifra, progressao []string, inicio, lacuna int) bool {
+	atual := inicio
+	for _, p := range progressao[1:] {
+		pulados := 0
+		k := atual + 1
+		for ; k < len(cifra) && cifra[k] != p; k++ {
+			if cifra[k] != cifra[atual] {
+				pulados++
+			}
+			if pulados > lacuna {
+				return false
+			}
+		}
+		if k == len(cifra) {
+			return false
+		}
+		atual = k
+	}
+	return true
+}
+
+// buscaPorProgressao filtra as músicas que contém a progressão (na ordem), retornando as MAX_RESULTADOS com mais
+// ocorrências.
+func buscaPorProgressao(musicas []*model.Musica, progressao []string, lacuna int) *resultado {
+	melhores := indice.NovaSelecao(MAX_RESULTADOS)
+	for _, m := range musicas {
+		if n := len(ocorrencias(m.Cifra, progressao, lacuna)); n > 0 {
+			melhores.Adiciona(&indice.Resultado{Musica: m, Pontuacao: float64(n)})
+		}
+	}
+	// As posições são calculadas novamente apenas para as músicas selecionadas.
+	return novoResultado(melhores, func(res *indice.Resultado) *SimilaresResposta {
+		r := novaResposta(res.Musica)
+		r.Cifra = res.Musica.Cifra
+		r.Posicoes = ocorrencias(res.Musica.Cifra, progressao, lacuna)
+		r.Pontuacao = res.Pontuacao
+		return r
+	})
+}
@@ -0,0 +1,30 @@
+package similares
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestOcorrencias(t *testing.T) {
+	data := []struct {
+		desc       string
+		cifra      []string
+		progressao []string
+		lacuna     int
+		want       []int
+	}{
+		{"contígua", []string{"Am", "F", "C", "G"}, []string{"Am", "F", "C", "G"}, 0, []int{0}},
+		{"primeiro acorde repetido", []string{"Am", "Am", "F", "C", "G"}, []string{"Am", "F", "C", "G"}, 0, []int{0}},
+		{"primeiro acorde repetido no meio", []string{"C", "Am", "Am", "Am", "F", "C", "G"}, []string{"Am", "F", "C", "G"}, 0, []int{1}},
+		{"acorde do meio repetido", []string{"Am", "F", "F", "C", "G"}, []string{"Am", "F", "C", "G"}, 0, []int{0}},
+		{"duas ocorrências", []string{"Am", "F", "C", "G", "Am", "Am", "F", "C", "G"}, []string{"Am", "F", "C", "G"}, 0, []int{0, 4}},
+		{"lacuna", []string{"Am", "Dm", "F", "C", "G"}, []string{"Am", "F", "C", "G"}, 1, []int{0}},
+		{"lacuna excedida", []string{"Am", "Dm", "E", "F", "C", "G"}, []string{"Am", "F", "C", "G"}, 1, nil},
+		{"fora de ordem", []string{"F", "Am", "G", "C"}, []string{"Am", "F", "C", "G"}, 0, nil},
+	}
+	for _, d := range data {
+		if got := ocorrencias(d.cifra, d.progressao, d.lacuna); !reflect.DeepEqual(got, d.want) {
+			t.Errorf("%s: ocorrencias(%v, %v, %d) = %v, want %v", d.desc, d.cifra, d.progressao, d.lacuna, got, d.want)
+		}
+	}
+}
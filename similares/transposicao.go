@@ -0,0 +1,82 @@
+package similares
+
+import (
+	"math"
+
+	"github.com/danielfireman/deciframe-api/acorde"
+	sets "github.com/deckarep/golang-set"
+)
+
+// consultaTransponivel guarda os acordes da consulta separados entre os que podem ser transpostos e os que não
+// puderam ser interpretados (esses são comparados literalmente em qualquer tom).
+type consultaTransponivel struct {
+	acordes []acorde.Acorde
+	outros  []string
+}
+
+func novaConsultaTransponivel(acordes []string) *consultaTransponivel {
+	c := &consultaTransponivel{}
+	for _, s := range acordes {
+		a, err := acorde.Parse(s)
+		if err != nil {
+			c.outros = append(c.outros, s)
+			continue
+		}
+		c.acordes = append(c.acordes, a)
+	}
+	return c
+}
+
+// graus retorna os acordes da consulta relativos ao tom passado. Se o tom não for conhecido (ou não puder ser
+// interpretado), retorna a união dos graus relativos a todas as 12 tônicas possíveis.
+func (c *consultaTransponivel) graus(tom string) []string {
+	if tonica, err := acorde.TonicaRelativa(tom); err == nil {
+		return c.grausRelativos(tonica)
+	}
+	uniao := sets.NewThreadUnsafeSet()
+	for t := 0; t < 12; t++ {
+		for _, g := range c.grausRelativos(t) {
+			uniao.Add(g)
+		}
+	}
+	var res []string
+	for g := range uniao.Iter() {
+		res = append(res, g.(string))
+	}
+	return res
+}
+
+func (c *consultaTransponivel) grausRelativos(tonica int) []string {
+	var res []string
+	for _, a := range c.acordes {
+		res = append(res, a.Grau(tonica))
+	}
+	return res
+}
+
+func (c *consultaTransponivel) transpoe(semitons int) sets.Set {
+	res := sets.NewThreadUnsafeSet()
+	for _, a := range c.acordes {
+		res.Add(a.Transpoe(semitons).String())
+	}
+	for _, o := range c.outros {
+		res.Add(o)
+	}
+	return res
+}
+
+// melhorTransposicao retorna o deslocamento em semitons (entre -5 e 6) que, aplicado aos acordes da consulta,
+// maximiza a interseção com os acordes da música. Em caso de empate, prefere o menor deslocamento. Também
+// retorna os acordes da consulta já transpostos.
+func (c *consultaTransponivel) melhorTransposicao(musica sets.Set) (int, sets.Set) {
+	melhor, melhorSet, melhorInter := 0, c.transpoe(0), -1
+	for t := 0; t < 12; t++ {
+		semitons := acorde.Intervalo(0, t)
+		transposta := c.transpoe(semitons)
+		inter := transposta.Intersect(musica).Cardinality()
+		if inter > melhorInter || (inter == melhorInter && math.Abs(float64(semitons)) < math.Abs(float64(melhor))) {
+			melhor, melhorSet, melhorInter = semitons, transposta, inter
+		}
+	}
+	return melhor, melhorSet
+}
@@ -0,0 +1,464 @@
+package similares
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/danielfireman/deciframe-api/acorde"
+	"github.com/danielfireman/deciframe-api/erro"
+	"github.com/danielfireman/deciframe-api/indice"
+)
+
+// Limites dos parâmetros de /similares, que protegem o repositório de consultas arbitrariamente grandes.
+const (
+	MAX_ACORDES       = 32  // Acordes em acordes, sequencia ou progressao.
+	MAX_GENEROS       = 10  // Gêneros em generos.
+	MAX_TAM_GENERO    = 64  // Caracteres de cada gênero.
+	MAX_TAM_ID_MUSICA = 128 // Caracteres de id_unico_musica e de cada música em excluir.
+	MAX_EXCLUIR       = 100 // Músicas em excluir.
+	MAX_PESO          = 10  // Maior peso aceito em pesos.
+
+	MAX_TAM_CORPO = 64 << 10 // Bytes do corpo de POST /similares.
+)
+
+// Modos de busca de /similares. Cada requisição deve informar exatamente um deles.
+const (
+	ModoAcordes    = "acordes"
+	ModoIDUnico    = "id_unico_musica"
+	ModoSequencia  = "sequencia"
+	ModoProgressao = "progressao"
+)
+
+var modos = []string{ModoAcordes, ModoIDUnico, ModoSequencia, ModoProgressao}
+
+// ConsultaSimilares é o corpo de POST /similares. As requisições GET são convertidas para ela, de forma que as duas
+// rotas compartilham a validação, a busca e o cache.
+type ConsultaSimilares struct {
+	Acordes       []string           `json:"acordes,omitempty"`
+	IDUnicoMusica string             `json:"id_unico_musica,omitempty"`
+	Sequencia     []string           `json:"sequencia,omitempty"`
+	Progressao    []string           `json:"progressao,omitempty"`
+	Lacuna        *int               `json:"lacuna,omitempty"`
+	Generos       []string           `json:"generos,omitempty"`
+	Ordenacao     string             `json:"ordenacao,omitempty"`
+	Pesos         map[string]float64 `json:"pesos,omitempty"`   // Multiplica o peso de cada acorde. Apenas com ordenacao=idf.
+	Excluir       []string           `json:"excluir,omitempty"` // id_unico_musica das músicas a ignorar.
+	Obrigatorios  []string           `json:"obrigatorios,omitempty"`
+	Proibidos     []string           `json:"proibidos,omitempty"`
+	MaxNovos      *int               `json:"max_novos,omitempty"`
+	Transpor      bool               `json:"transpor,omitempty"`
+	Tom           string             `json:"tom,omitempty"`
+	Pagina        int                `json:"pagina,omitempty"`
+	Tamanho       int                `json:"tamanho,omitempty"`
+}
+
+// consulta é uma ConsultaSimilares validada e normalizada: acordes canônicos, conjuntos ordenados e sem repetições,
+// ordenação padrão preenchida e sem as opções de paginação. Consultas equivalentes são iguais depois de
+// normalizadas.
+type consulta struct {
+	ConsultaSimilares
+	modo     string
+	criterio Pontuador
+}
+
+// excluidas retorna as músicas ignoradas pela busca: as de excluir e, na busca por id_unico_musica, a própria música.
+func (c *consulta) excluidas() map[string]bool {
+	res := make(map[string]bool)
+	for _, id := range c.Excluir {
+		res[id] = true
+	}
+	if c.IDUnicoMusica != "" {
+		res[c.IDUnicoMusica] = true
+	}
+	return res
+}
+
+// filtro retorna as restrições aos acordes das músicas.
+func (c *consulta) filtro() indice.Filtro {
+	return indice.Filtro{Obrigatorios: c.Obrigatorios, Proibidos: c.Proibidos, MaxNovos: c.MaxNovos}
+}
+
+// consultaDaURL converte os parâmetros de GET /similares. Os erros de sintaxe dos parâmetros (listas de acordes,
+// inteiros e booleanos) são detectados aqui; os demais, em valida.
+func consultaDaURL(q url.Values) (*ConsultaSimilares, *erro.Erro) {
+	c := &ConsultaSimilares{
+		IDUnicoMusica: q.Get("id_unico_musica"),
+		Generos:       lista(q.Get("generos")),
+		Ordenacao:     q.Get("ordenacao"),
+		Excluir:       lista(q.Get("excluir")),
+		Tom:           q.Get("tom"),
+	}
+	var e *erro.Erro
+	if c.Acordes, e = acordesDaURL(ModoAcordes, q.Get(ModoAcordes)); e != nil {
+		return nil, e
+	}
+	if c.Sequencia, e = acordesDaURL(ModoSequencia, q.Get(ModoSequencia)); e != nil {
+		return nil, e
+	}
+	if c.Progressao, e = acordesDaURL(ModoProgressao, q.Get(ModoProgressao)); e != nil {
+		return nil, e
+	}
+	if c.Obrigatorios, e = acordesDaURL("obrigatorios", q.Get("obrigatorios")); e != nil {
+		return nil, e
+	}
+	if c.Proibidos, e = acordesDaURL("proibidos", q.Get("proibidos")); e != nil {
+		return nil, e
+	}
+	if q.Get("max_novos") != "" {
+		maxNovos, err := strconv.Atoi(q.Get("max_novos"))
+		if err != nil {
+			return nil, erroMaxNovos(q.Get("max_novos"))
+		}
+		c.MaxNovos = &maxNovos
+	}
+	if q.Get("lacuna") != "" {
+		lacuna, err := strconv.Atoi(q.Get("lacuna"))
+		if err != nil {
+			return nil, erroLacuna(q.Get("lacuna"))
+		}
+		c.Lacuna = &lacuna
+	}
+	switch q.Get("transpor") {
+	case "", "false":
+	case "true":
+		c.Transpor = true
+	default:
+		return nil, erro.ParametroInvalido(
+			"transpor deve ser true ou false: "+q.Get("transpor"),
+			"transpor must be true or false: "+q.Get("transpor"))
+	}
+	return c, nil
+}
+
+// acordesDaURL separa a lista de acordes do parâmetro, separados por vírgula. Parâmetros informados devem conter ao
+// menos um acorde válido.
+func acordesDaURL(parametro, valor string) ([]string, *erro.Erro) {
+	if valor == "" {
+		return nil, nil
+	}
+	acordes, err := acorde.SeparaEstrito(valor)
+	if err != nil {
+		return nil, erroAcorde(parametro, valor, err)
+	}
+	if len(acordes) == 0 {
+		return nil, erroNumAcordes(parametro)
+	}
+	return acordes, nil
+}
+
+// lista separa valores separados por vírgula, sem descartar os vazios, que são recusados pela validação.
+func lista(valor string) []string {
+	if valor == "" {
+		return nil
+	}
+	return strings.Split(valor, ",")
+}
+
+// valida verifica a consulta, retornando um erro de parâmetro inválido com o motivo da primeira violação
+// encontrada, e a normaliza.
+func (q *ConsultaSimilares) valida() (*consulta, *erro.Erro) {
+	c := &consulta{}
+	var informados []string
+	for _, m := range modos {
+		if q.informado(m) {
+			informados = append(informados, m)
+		}
+	}
+	switch len(informados) {
+	case 0:
+		return nil, erro.ParametroInvalido(
+			"Informe um dos parâmetros: "+strings.Join(modos, ", "),
+			"One of these parameters is required: "+strings.Join(modos, ", "))
+	case 1:
+		c.modo = informados[0]
+	default:
+		return nil, erro.ParametroInvalido(
+			"Os parâmetros não podem ser usados juntos: "+strings.Join(informados, ", "),
+			"These parameters cannot be used together: "+strings.Join(informados, ", "))
+	}
+
+	var e *erro.Erro
+	switch c.modo {
+	case ModoIDUnico:
+		if len(q.IDUnicoMusica) > MAX_TAM_ID_MUSICA {
+			return nil, erro.ParametroInvalido(
+				fmt.Sprintf("id_unico_musica deve ter no máximo %d caracteres.", MAX_TAM_ID_MUSICA),
+				fmt.Sprintf("id_unico_musica must have at most %d characters.", MAX_TAM_ID_MUSICA))
+		}
+		c.IDUnicoMusica = q.IDUnicoMusica
+	case ModoAcordes:
+		if c.Acordes, e = canonicos(ModoAcordes, q.Acordes); e != nil {
+			return nil, e
+		}
+		c.Acordes = ordenados(c.Acordes)
+	case ModoSequencia:
+		if c.Sequencia, e = canonicos(ModoSequencia, q.Sequencia); e != nil {
+			return nil, e
+		}
+	case ModoProgressao:
+		if c.Progressao, e = canonicos(ModoProgressao, q.Progressao); e != nil {
+			return nil, e
+		}
+	}
+
+	if c.Generos, e = validaGeneros(q.Generos); e != nil {
+		return nil, e
+	}
+	if c.Excluir, e = validaExcluir(q.Excluir); e != nil {
+		return nil, e
+	}
+
+	if e = c.validaFiltro(q); e != nil {
+		return nil, e
+	}
+
+	if q.Lacuna != nil && c.modo != ModoProgressao {
+		return nil, erro.ParametroInvalido(
+			"lacuna só pode ser usado com progressao.",
+			"lacuna can only be used with progressao.")
+	}
+	if c.modo == ModoProgressao {
+		lacuna := 0
+		if q.Lacuna != nil {
+			lacuna = *q.Lacuna
+		}
+		if lacuna < 0 || lacuna > MAX_LACUNA {
+			return nil, erroLacuna(strconv.Itoa(lacuna))
+		}
+		c.Lacuna = &lacuna
+	}
+
+	// tom, transpor, ordenacao e pesos valem apenas para as buscas por semelhança.
+	semelhanca := c.modo == ModoAcordes || c.modo == ModoIDUnico
+	if q.Transpor && !semelhanca {
+		return nil, erro.ParametroInvalido(
+			"transpor só pode ser usado com acordes ou id_unico_musica.",
+			"transpor can only be used with acordes or id_unico_musica.")
+	}
+	c.Transpor = q.Transpor
+	if q.Tom != "" {
+		// Sem transpor o tom não tem efeito, mas mudaria a chave do cache.
+		if c.modo != ModoAcordes || !c.Transpor {
+			return nil, erro.ParametroInvalido(
+				"tom só pode ser usado com acordes e transpor=true.",
+				"tom can only be used with acordes and transpor=true.")
+		}
+		t, err := acorde.Parse(q.Tom)
+		if err != nil {
+			return nil, erro.ParametroInvalido(
+				"tom deve ser um acorde ou nota (ex: C, F#m): "+q.Tom,
+				"tom must be a chord or note (e.g. C, F#m): "+q.Tom)
+		}
+		c.Tom = t.String()
+	}
+	if q.Ordenacao != "" && !semelhanca {
+		return nil, erro.ParametroInvalido(
+			"ordenacao só pode ser usado com acordes ou id_unico_musica.",
+			"ordenacao can only be used with acordes or id_unico_musica.")
+	}
+	if c.criterio, e = pontuador(q.Ordenacao); e != nil {
+		return nil, e
+	}
+	if semelhanca {
+		c.Ordenacao = q.Ordenacao
+		if c.Ordenacao == "" {
+			c.Ordenacao = OrdenacaoDiferenca
+		}
+	}
+	if len(q.Pesos) > 0 {
+		if c.Ordenacao != OrdenacaoIDF || c.Transpor {
+			return nil, erro.ParametroInvalido(
+				"pesos só pode ser usado com ordenacao=idf e sem transpor.",
+				"pesos can only be used with ordenacao=idf and without transpor.")
+		}
+		if c.Pesos, e = validaPesos(q.Pesos); e != nil {
+			return nil, e
+		}
+	}
+	return c, nil
+}
+
+// validaFiltro verifica e normaliza obrigatorios, proibidos e max_novos. Um acorde não pode ser obrigatório e
+// proibido ao mesmo tempo.
+func (c *consulta) validaFiltro(q *ConsultaSimilares) *erro.Erro {
+	var e *erro.Erro
+	if c.Obrigatorios, e = canonicos("obrigatorios", q.Obrigatorios); e != nil {
+		return e
+	}
+	if c.Proibidos, e = canonicos("proibidos", q.Proibidos); e != nil {
+		return e
+	}
+	c.Obrigatorios, c.Proibidos = ordenados(c.Obrigatorios), ordenados(c.Proibidos)
+	if ambos := conjunto(c.Obrigatorios).Intersect(conjunto(c.Proibidos)); ambos.Cardinality() > 0 {
+		var acordes []string
+		for a := range ambos.Iter() {
+			acordes = append(acordes, a.(string))
+		}
+		sort.Strings(acordes)
+		return erro.ParametroInvalido(
+			"Acordes não podem ser obrigatórios e proibidos ao mesmo tempo: "+strings.Join(acordes, ","),
+			"Chords cannot be both required and forbidden: "+strings.Join(acordes, ","))
+	}
+	if (len(c.Obrigatorios) > 0 || len(c.Proibidos) > 0) && q.Transpor {
+		return erro.ParametroInvalido(
+			"obrigatorios e proibidos não podem ser usados com transpor.",
+			"obrigatorios and proibidos cannot be used with transpor.")
+	}
+	if q.MaxNovos != nil {
+		if *q.MaxNovos < 0 {
+			return erroMaxNovos(strconv.Itoa(*q.MaxNovos))
+		}
+		maxNovos := *q.MaxNovos
+		c.MaxNovos = &maxNovos
+	}
+	return nil
+}
+
+func (q *ConsultaSimilares) informado(modo string) bool {
+	switch modo {
+	case ModoAcordes:
+		return len(q.Acordes) > 0
+	case ModoIDUnico:
+		return q.IDUnicoMusica != ""
+	case ModoSequencia:
+		return len(q.Sequencia) > 0
+	case ModoProgressao:
+		return len(q.Progressao) > 0
+	}
+	return false
+}
+
+// canonicos interpreta os acordes do parâmetro, que deve ter entre 1 e MAX_ACORDES acordes válidos.
+func canonicos(parametro string, acordes []string) ([]string, *erro.Erro) {
+	if len(acordes) > MAX_ACORDES {
+		return nil, erroNumAcordes(parametro)
+	}
+	res := make([]string, len(acordes))
+	for i, s := range acordes {
+		a, err := acorde.Parse(s)
+		if err != nil {
+			return nil, erroAcorde(parametro, s, err)
+		}
+		res[i] = a.String()
+	}
+	return res, nil
+}
+
+// validaGeneros verifica os gêneros, que devem ser no máximo MAX_GENEROS, não vazios e com no máximo
+// MAX_TAM_GENERO caracteres. Os valores aceitos são os listados por /generos.
+func validaGeneros(generos []string) ([]string, *erro.Erro) {
+	if len(generos) > MAX_GENEROS {
+		return nil, erro.ParametroInvalido(
+			fmt.Sprintf("generos deve ter no máximo %d gêneros.", MAX_GENEROS),
+			fmt.Sprintf("generos must have at most %d genres.", MAX_GENEROS))
+	}
+	var res []string
+	for _, g := range generos {
+		g = strings.TrimSpace(g)
+		if g == "" || len(g) > MAX_TAM_GENERO {
+			return nil, erro.ParametroInvalido(
+				fmt.Sprintf("Cada gênero deve ter entre 1 e %d caracteres: %s", MAX_TAM_GENERO, strings.Join(generos, ",")),
+				fmt.Sprintf("Each genre must have between 1 and %d characters: %s", MAX_TAM_GENERO, strings.Join(generos, ",")))
+		}
+		res = append(res, g)
+	}
+	return ordenados(res), nil
+}
+
+// validaExcluir verifica as músicas a ignorar: no máximo MAX_EXCLUIR identificadores não vazios.
+func validaExcluir(ids []string) ([]string, *erro.Erro) {
+	if len(ids) > MAX_EXCLUIR {
+		return nil, erro.ParametroInvalido(
+			fmt.Sprintf("excluir deve ter no máximo %d músicas.", MAX_EXCLUIR),
+			fmt.Sprintf("excluir must have at most %d songs.", MAX_EXCLUIR))
+	}
+	var res []string
+	for _, id := range ids {
+		id = strings.TrimSpace(id)
+		if id == "" || len(id) > MAX_TAM_ID_MUSICA {
+			return nil, erro.ParametroInvalido(
+				fmt.Sprintf("Cada música em excluir deve ter entre 1 e %d caracteres.", MAX_TAM_ID_MUSICA),
+				fmt.Sprintf("Each song in excluir must have between 1 and %d characters.", MAX_TAM_ID_MUSICA))
+		}
+		res = append(res, id)
+	}
+	return ordenados(res), nil
+}
+
+// validaPesos verifica os pesos: no máximo MAX_ACORDES acordes válidos, com pesos maiores que zero e até MAX_PESO.
+func validaPesos(pesos map[string]float64) (map[string]float64, *erro.Erro) {
+	if len(pesos) > MAX_ACORDES {
+		return nil, erroNumAcordes("pesos")
+	}
+	// Percorremos os acordes em ordem para que o erro reportado não dependa da ordem de iteração do mapa.
+	var nomes []string
+	for s := range pesos {
+		nomes = append(nomes, s)
+	}
+	sort.Strings(nomes)
+	res := make(map[string]float64, len(pesos))
+	origem := make(map[string]string, len(pesos))
+	for _, s := range nomes {
+		p := pesos[s]
+		a, err := acorde.Parse(s)
+		if err != nil {
+			return nil, erroAcorde("pesos", s, err)
+		}
+		if p <= 0 || p > MAX_PESO {
+			return nil, erro.ParametroInvalido(
+				fmt.Sprintf("pesos: o peso de %s deve ser maior que zero e no máximo %d: %v", s, MAX_PESO, p),
+				fmt.Sprintf("pesos: the weight of %s must be greater than zero and at most %d: %v", s, MAX_PESO, p))
+		}
+		canonico := a.String()
+		if anterior, ok := origem[canonico]; ok {
+			return nil, erro.ParametroInvalido(
+				fmt.Sprintf("pesos: %s e %s são o mesmo acorde (%s)", anterior, s, canonico),
+				fmt.Sprintf("pesos: %s and %s are the same chord (%s)", anterior, s, canonico))
+		}
+		origem[canonico] = s
+		res[canonico] = p
+	}
+	return res, nil
+}
+
+// ordenados ordena os valores, removendo as repetições.
+func ordenados(valores []string) []string {
+	if len(valores) == 0 {
+		return nil
+	}
+	sort.Strings(valores)
+	res := valores[:1]
+	for _, v := range valores[1:] {
+		if v != res[len(res)-1] {
+			res = append(res, v)
+		}
+	}
+	return res
+}
+
+func erroAcorde(parametro, valor string, err error) *erro.Erro {
+	return erro.ParametroInvalido(
+		fmt.Sprintf("%s: %v (acordes válidos são como C, F#m7, Bb7M, D/F#)", parametro, err),
+		fmt.Sprintf("%s: invalid chord in %s (valid chords look like C, F#m7, Bb7M, D/F#)", parametro, valor))
+}
+
+func erroNumAcordes(parametro string) *erro.Erro {
+	return erro.ParametroInvalido(
+		fmt.Sprintf("%s deve ter entre 1 e %d acordes.", parametro, MAX_ACORDES),
+		fmt.Sprintf("%s must have between 1 and %d chords.", parametro, MAX_ACORDES))
+}
+
+func erroMaxNovos(valor string) *erro.Erro {
+	return erro.ParametroInvalido(
+		"max_novos deve ser um inteiro maior ou igual a zero: "+valor,
+		"max_novos must be an integer greater than or equal to zero: "+valor)
+}
+
+func erroLacuna(valor string) *erro.Erro {
+	return erro.ParametroInvalido(
+		fmt.Sprintf("lacuna deve ser um inteiro entre 0 e %d: %s", MAX_LACUNA, valor),
+		fmt.Sprintf("lacuna must be an integer between 0 and %d: %s", MAX_LACUNA, valor))
+}
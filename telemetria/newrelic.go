@@ -0,0 +1,48 @@
+package telemetria
+
+import (
+	"net/http"
+
+	"github.com/newrelic/go-agent"
+)
+
+// NewRelic conecta ao New Relic com a licença passada.
+func NewRelic(nomeApp, licenca string) (Telemetria, error) {
+	app, err := newrelic.NewApplication(newrelic.NewConfig(nomeApp, licenca))
+	if err != nil {
+		return nil, err
+	}
+	return &nr{app: app}, nil
+}
+
+type nr struct {
+	app newrelic.Application
+}
+
+func (n *nr) IniciaTransacao(nome string, w http.ResponseWriter, r *http.Request) Transacao {
+	return transacaoNR{n.app.StartTransaction(nome, w, r)}
+}
+
+type transacaoNR struct {
+	newrelic.Transaction
+}
+
+func (t transacaoNR) Segmento(nome string) Segmento {
+	return segmentoNR{newrelic.StartSegment(t.Transaction, nome)}
+}
+
+func (t transacaoNR) Cache(acerto bool) {
+	t.AddAttribute("cache", acerto)
+}
+
+func (t transacaoNR) Fim() {
+	t.End()
+}
+
+type segmentoNR struct {
+	newrelic.Segment
+}
+
+func (s segmentoNR) Fim() {
+	s.End()
+}
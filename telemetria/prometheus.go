@@ -0,0 +1,178 @@
+package telemetria
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Limites (em segundos) dos buckets dos histogramas de latência.
+var BUCKETS = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// Prometheus acumula as métricas em memória e as expõe no formato texto do Prometheus:
+//
+//	deciframe_requisicoes_total{endpoint,status}
+//	deciframe_requisicao_duracao_segundos{endpoint} (histograma)
+//	deciframe_segmento_duracao_segundos{endpoint,segmento} (histograma)
+//	deciframe_cache_total{endpoint,resultado="acerto"|"falha"}
+type Prometheus struct {
+	mu          sync.Mutex
+	requisicoes map[string]float64 // Chave: rótulos já formatados.
+	duracoes    map[string]*histograma
+	segmentos   map[string]*histograma
+	cache       map[string]float64
+}
+
+func NovoPrometheus() *Prometheus {
+	return &Prometheus{
+		requisicoes: make(map[string]float64),
+		duracoes:    make(map[string]*histograma),
+		segmentos:   make(map[string]*histograma),
+		cache:       make(map[string]float64),
+	}
+}
+
+func (p *Prometheus) IniciaTransacao(nome string, w http.ResponseWriter, r *http.Request) Transacao {
+	return &transacaoPrometheus{ResponseWriter: w, p: p, endpoint: nome, inicio: time.Now(), status: http.StatusOK}
+}
+
+// Handler expõe as métricas, para ser registrado em /metrics.
+func (p *Prometheus) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		p.Escreve(w)
+	})
+}
+
+// Escreve as métricas no formato texto do Prometheus.
+func (p *Prometheus) Escreve(w io.Writer) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	fmt.Fprintln(w, "# HELP deciframe_requisicoes_total Requisições atendidas, por endpoint e status HTTP.")
+	fmt.Fprintln(w, "# TYPE deciframe_requisicoes_total counter")
+	escreveContadores(w, "deciframe_requisicoes_total", p.requisicoes)
+	fmt.Fprintln(w, "# HELP deciframe_requisicao_duracao_segundos Latência das requisições, por endpoint.")
+	fmt.Fprintln(w, "# TYPE deciframe_requisicao_duracao_segundos histogram")
+	escreveHistogramas(w, "deciframe_requisicao_duracao_segundos", p.duracoes)
+	fmt.Fprintln(w, "# HELP deciframe_segmento_duracao_segundos Latência de cada etapa das requisições.")
+	fmt.Fprintln(w, "# TYPE deciframe_segmento_duracao_segundos histogram")
+	escreveHistogramas(w, "deciframe_segmento_duracao_segundos", p.segmentos)
+	fmt.Fprintln(w, "# HELP deciframe_cache_total Consultas ao cache, por endpoint e resultado (acerto ou falha).")
+	fmt.Fprintln(w, "# TYPE deciframe_cache_total counter")
+	escreveContadores(w, "deciframe_cache_total", p.cache)
+}
+
+func (p *Prometheus) observa(m map[string]*histograma, rotulos string, d time.Duration) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	h, ok := m[rotulos]
+	if !ok {
+		h = &histograma{buckets: make([]float64, len(BUCKETS))}
+		m[rotulos] = h
+	}
+	h.observa(d.Seconds())
+}
+
+func (p *Prometheus) incrementa(m map[string]float64, rotulos string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	m[rotulos]++
+}
+
+type transacaoPrometheus struct {
+	http.ResponseWriter
+	p        *Prometheus
+	endpoint string
+	inicio   time.Time
+	status   int
+}
+
+func (t *transacaoPrometheus) WriteHeader(status int) {
+	t.status = status
+	t.ResponseWriter.WriteHeader(status)
+}
+
+func (t *transacaoPrometheus) Segmento(nome string) Segmento {
+	return &segmentoPrometheus{t: t, nome: nome, inicio: time.Now()}
+}
+
+func (t *transacaoPrometheus) Cache(acerto bool) {
+	resultado := "falha"
+	if acerto {
+		resultado = "acerto"
+	}
+	t.p.incrementa(t.p.cache, rotulos("endpoint", t.endpoint, "resultado", resultado))
+}
+
+func (t *transacaoPrometheus) Fim() {
+	t.p.incrementa(t.p.requisicoes, rotulos("endpoint", t.endpoint, "status", strconv.Itoa(t.status)))
+	t.p.observa(t.p.duracoes, rotulos("endpoint", t.endpoint), time.Since(t.inicio))
+}
+
+type segmentoPrometheus struct {
+	t      *transacaoPrometheus
+	nome   string
+	inicio time.Time
+}
+
+func (s *segmentoPrometheus) Fim() {
+	s.t.p.observa(s.t.p.segmentos, rotulos("endpoint", s.t.endpoint, "segmento", s.nome), time.Since(s.inicio))
+}
+
+type histograma struct {
+	buckets []float64 // Contagem cumulativa por limite de BUCKETS.
+	soma    float64
+	total   float64
+}
+
+func (h *histograma) observa(v float64) {
+	for i, limite := range BUCKETS {
+		if v <= limite {
+			h.buckets[i]++
+		}
+	}
+	h.soma += v
+	h.total++
+}
+
+// rotulos formata pares nome, valor como rótulos do Prometheus: nome1="valor1",nome2="valor2".
+func rotulos(pares ...string) string {
+	var partes []string
+	for i := 0; i+1 < len(pares); i += 2 {
+		partes = append(partes, fmt.Sprintf("%s=%s", pares[i], strconv.Quote(pares[i+1])))
+	}
+	return strings.Join(partes, ",")
+}
+
+func escreveContadores(w io.Writer, nome string, m map[string]float64) {
+	var chaves []string
+	for r := range m {
+		chaves = append(chaves, r)
+	}
+	sort.Strings(chaves)
+	for _, r := range chaves {
+		fmt.Fprintf(w, "%s{%s} %g\n", nome, r, m[r])
+	}
+}
+
+func escreveHistogramas(w io.Writer, nome string, m map[string]*histograma) {
+	var chaves []string
+	for r := range m {
+		chaves = append(chaves, r)
+	}
+	sort.Strings(chaves)
+	for _, r := range chaves {
+		h := m[r]
+		for i, limite := range BUCKETS {
+			fmt.Fprintf(w, "%s_bucket{%s,le=\"%g\"} %g\n", nome, r, limite, h.buckets[i])
+		}
+		fmt.Fprintf(w, "%s_bucket{%s,le=\"+Inf\"} %g\n", nome, r, h.total)
+		fmt.Fprintf(w, "%s_sum{%s} %g\n", nome, r, h.soma)
+		fmt.Fprintf(w, "%s_count{%s} %g\n", nome, r, h.total)
+	}
+}
@@ -0,0 +1,108 @@
+// Package telemetria define a interface de rastreamento e métricas usada pelos tratadores e suas implementações:
+// New Relic, Prometheus (exposto em /metrics) e nula, usada quando nenhuma outra está configurada.
+package telemetria
+
+import "net/http"
+
+type Telemetria interface {
+	// IniciaTransacao começa a medir o tratamento de uma requisição. A resposta deve ser escrita na Transacao
+	// retornada, que é o http.ResponseWriter instrumentado.
+	IniciaTransacao(nome string, w http.ResponseWriter, r *http.Request) Transacao
+}
+
+type Transacao interface {
+	http.ResponseWriter
+
+	// Segmento começa a medir uma etapa da requisição (ex: busca_cache, busca_similares, marshal).
+	Segmento(nome string) Segmento
+
+	// Cache registra se a resposta foi encontrada no cache.
+	Cache(acerto bool)
+
+	Fim()
+}
+
+type Segmento interface {
+	Fim()
+}
+
+// Nula retorna uma Telemetria que não mede nada.
+func Nula() Telemetria {
+	return nula{}
+}
+
+type nula struct{}
+
+func (nula) IniciaTransacao(nome string, w http.ResponseWriter, r *http.Request) Transacao {
+	return transacaoNula{w}
+}
+
+type transacaoNula struct {
+	http.ResponseWriter
+}
+
+func (transacaoNula) Segmento(nome string) Segmento { return segmentoNulo{} }
+func (transacaoNula) Cache(acerto bool)             {}
+func (transacaoNula) Fim()                          {}
+
+type segmentoNulo struct{}
+
+func (segmentoNulo) Fim() {}
+
+// Combina envia as medições para todas as telemetrias passadas. Cada transação envolve o http.ResponseWriter da
+// anterior, de forma que todas observam a resposta.
+func Combina(telemetrias ...Telemetria) Telemetria {
+	switch len(telemetrias) {
+	case 0:
+		return Nula()
+	case 1:
+		return telemetrias[0]
+	}
+	return combinada(telemetrias)
+}
+
+type combinada []Telemetria
+
+func (c combinada) IniciaTransacao(nome string, w http.ResponseWriter, r *http.Request) Transacao {
+	t := make(transacaoCombinada, len(c))
+	for i, tel := range c {
+		t[i] = tel.IniciaTransacao(nome, w, r)
+		w = t[i]
+	}
+	return t
+}
+
+// transacaoCombinada escreve a resposta na última transação, a mais externa.
+type transacaoCombinada []Transacao
+
+func (t transacaoCombinada) Header() http.Header         { return t[len(t)-1].Header() }
+func (t transacaoCombinada) Write(b []byte) (int, error) { return t[len(t)-1].Write(b) }
+func (t transacaoCombinada) WriteHeader(status int)      { t[len(t)-1].WriteHeader(status) }
+
+func (t transacaoCombinada) Segmento(nome string) Segmento {
+	s := make(segmentoCombinado, len(t))
+	for i, txn := range t {
+		s[i] = txn.Segmento(nome)
+	}
+	return s
+}
+
+func (t transacaoCombinada) Cache(acerto bool) {
+	for _, txn := range t {
+		txn.Cache(acerto)
+	}
+}
+
+func (t transacaoCombinada) Fim() {
+	for i := len(t) - 1; i >= 0; i-- {
+		t[i].Fim()
+	}
+}
+
+type segmentoCombinado []Segmento
+
+func (s segmentoCombinado) Fim() {
+	for i := len(s) - 1; i >= 0; i-- {
+		s[i].Fim()
+	}
+}